@@ -0,0 +1,110 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+//go:embed aliases.json
+var defaultAliases []byte
+
+// Alias maps a short program name to a github repository,
+// along with the default settings used to install it
+type Alias struct {
+	Repo   string `json:"repo"`             // user/repo
+	As     string `json:"as,omitempty"`     // installed binary name
+	Select string `json:"select,omitempty"` // asset name filter
+	Bin    string `json:"bin,omitempty"`    // binary name inside the release asset
+}
+
+func (a Alias) validate() error {
+	user, program := splitHalf(a.Repo, "/")
+	if !lockNameRe.MatchString(user) || !lockNameRe.MatchString(program) {
+		return fmt.Errorf("invalid repo '%s', expected user/repo", a.Repo)
+	}
+	if a.As != "" && !binNameRe.MatchString(a.As) {
+		return fmt.Errorf("invalid as '%s'", a.As)
+	}
+	if a.Bin != "" && !binNameRe.MatchString(a.Bin) {
+		return fmt.Errorf("invalid bin '%s'", a.Bin)
+	}
+	return nil
+}
+
+// LoadAliases returns the default alias registry, with the
+// aliases in the given json file (if any) taking precedence
+func LoadAliases(file string) (map[string]Alias, error) {
+	aliases := map[string]Alias{}
+	if err := parseAliases(defaultAliases, aliases); err != nil {
+		return nil, fmt.Errorf("default aliases: %w", err)
+	}
+	if file == "" {
+		return aliases, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseAliases(b, aliases); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return aliases, nil
+}
+
+func parseAliases(b []byte, aliases map[string]Alias) error {
+	m := map[string]Alias{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for name, a := range m {
+		if !binNameRe.MatchString(name) {
+			return fmt.Errorf("invalid alias name '%s'", name)
+		}
+		if err := a.validate(); err != nil {
+			return fmt.Errorf("alias %s: %w", name, err)
+		}
+		aliases[strings.ToLower(name)] = a
+	}
+	return nil
+}
+
+// aliases used by the handler, defaults to the embedded registry
+func (h *Handler) aliases() map[string]Alias {
+	if h.Aliases != nil {
+		return h.Aliases
+	}
+	h.aliasOnce.Do(func() {
+		h.defaultAliases, _ = LoadAliases("")
+	})
+	return h.defaultAliases
+}
+
+// applyAlias sets the repository of a program name
+// found in the registry, query params take precedence
+func (h *Handler) applyAlias(q Query) (Query, bool) {
+	a, ok := h.aliases()[strings.ToLower(q.Program)]
+	if !ok {
+		return q, false
+	}
+	q.User, q.Program = splitHalf(a.Repo, "/")
+	if q.AsProgram == "" {
+		q.AsProgram = a.As
+	}
+	if q.Select == "" {
+		q.Select = a.Select
+	}
+	if q.Bin == "" {
+		q.Bin = a.Bin
+	}
+	return q, true
+}
+
+func (h *Handler) serveAliases(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(h.aliases(), "", "  ")
+	w.Write(b)
+}
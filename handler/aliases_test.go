@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAliases(t *testing.T) {
+	aliases, err := LoadAliases("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := aliases["rg"]; a.Repo != "BurntSushi/ripgrep" || a.As != "rg" {
+		t.Fatalf("unexpected rg alias: %+v", a)
+	}
+	// override file takes precedence
+	file := filepath.Join(t.TempDir(), "aliases.json")
+	os.WriteFile(file, []byte(`{"rg": {"repo": "acme/rg"}, "Foo": {"repo": "acme/foo", "bin": "foo"}}`), 0644)
+	if aliases, err = LoadAliases(file); err != nil {
+		t.Fatal(err)
+	}
+	if a := aliases["rg"]; a.Repo != "acme/rg" || a.As != "" {
+		t.Fatalf("expected rg alias to be overridden: %+v", a)
+	}
+	if a := aliases["foo"]; a.Repo != "acme/foo" || a.Bin != "foo" {
+		t.Fatalf("unexpected foo alias: %+v", a)
+	}
+	if _, ok := aliases["micro"]; !ok {
+		t.Fatalf("expected default aliases to be kept")
+	}
+	// aliases are embedded in scripts
+	for _, invalid := range []string{
+		`{"foo": {"repo": "acme"}}`,
+		`{"foo": {"repo": "acme/foo", "bin": "$(reboot)"}}`,
+		`{"foo bar": {"repo": "acme/foo"}}`,
+	} {
+		os.WriteFile(file, []byte(invalid), 0644)
+		if _, err := LoadAliases(file); err == nil {
+			t.Fatalf("expected %s to be invalid", invalid)
+		}
+	}
+}
+
+func TestRouteAlias(t *testing.T) {
+	h := &Handler{Config: Config{User: "jpillora"}}
+	q := h.routeQuery(Query{}, "rg@14")
+	if q.User != "BurntSushi" || q.Program != "ripgrep" || q.Release != "14" || q.AsProgram != "rg" || q.Bin != "rg" || q.Search {
+		t.Fatalf("unexpected rg query: %+v", q)
+	}
+	// query params take precedence
+	if q := h.routeQuery(Query{AsProgram: "ripgrep"}, "rg"); q.AsProgram != "ripgrep" {
+		t.Fatalf("expected as to be kept: %+v", q)
+	}
+	// explicit user/repo and unknown programs are not aliased
+	if q := h.routeQuery(Query{}, "acme/rg"); q.User != "acme" || q.Program != "rg" {
+		t.Fatalf("unexpected acme/rg query: %+v", q)
+	}
+	if q := h.routeQuery(Query{}, "serve"); q.User != "jpillora" || !q.Search {
+		t.Fatalf("unexpected serve query: %+v", q)
+	}
+	// served as json
+	h.Aliases = map[string]Alias{"foo": {Repo: "acme/foo"}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/aliases", nil))
+	aliases := map[string]Alias{}
+	if err := json.Unmarshal(w.Body.Bytes(), &aliases); err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 1 || aliases["foo"].Repo != "acme/foo" {
+		t.Fatalf("unexpected aliases: %s", w.Body.String())
+	}
+}
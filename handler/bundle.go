@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/jpillora/installer/scripts"
+)
+
+// maximum number of tools in a bundle
+const maxBundleTools = 32
+
+// bundleTool is a resolved bundle query,
+// or the error which occurred while resolving it
+type bundleTool struct {
+	QueryResult
+	Name  string // as requested
+	Error string
+}
+
+// bundle returns the queries of a named bundle. bundles
+// are defined as <name>=<query>,<query>... and multiple
+// bundles may be separated by whitespace (env).
+func (c Config) bundle(name string) (string, bool) {
+	for _, b := range c.Bundles {
+		for _, def := range strings.Fields(b) {
+			if n, queries := splitHalf(def, "="); n == name {
+				return queries, true
+			}
+		}
+	}
+	return "", false
+}
+
+// serveBundle resolves a comma separated list of queries (or a named
+// bundle) and renders a single script which installs all of them
+func (h *Handler) serveBundle(w http.ResponseWriter, r *http.Request) {
+	showError := func(msg string, code int) {
+		// prevent shell injection
+		cleaned := errMsgRe.ReplaceAllString(msg, "")
+		http.Error(w, fmt.Sprintf("echo '%s'", cleaned), code)
+	}
+	list := strings.TrimPrefix(r.URL.Path, "/bundle/")
+	// move all to path with !
+	move := r.URL.Query().Get("move") == "1"
+	if strings.HasSuffix(list, "!") {
+		move = true
+		list = strings.TrimRight(list, "!")
+	}
+	if queries, ok := h.Config.bundle(list); ok {
+		list = queries
+	}
+	names := []string{}
+	for _, n := range strings.Split(list, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		showError("Empty bundle", http.StatusBadRequest)
+		return
+	}
+	if len(names) > maxBundleTools {
+		showError(fmt.Sprintf("Too many bundle tools (max %d)", maxBundleTools), http.StatusBadRequest)
+		return
+	}
+	dir, err := installDir(r.URL.Query())
+	if err != nil {
+		showError(err.Error(), http.StatusBadRequest)
+		return
+	}
+	// shared by all tools
+	base := Query{
+		Insecure: r.URL.Query().Get("insecure") == "1",
+		OS:       r.URL.Query().Get("os"),
+		Arch:     r.URL.Query().Get("arch"),
+		Force:    r.URL.Query().Get("force") == "1",
+		Dir:      dir,
+		// bundle releases may be version constraints, like lock queries
+		Constraint: true,
+
+		Unquarantine: r.URL.Query().Get("unquarantine") == "1",
+	}
+	confirm := r.URL.Query().Get("confirm") == "1"
+	// resolve concurrently
+	tools := make([]bundleTool, len(names))
+	wg := sync.WaitGroup{}
+	for i, name := range names {
+		q := base
+		// move a single tool to path with !
+		q.MoveToPath = move || strings.HasSuffix(name, "!")
+		q = h.routeQuery(q, strings.TrimRight(name, "!"))
+		wg.Add(1)
+		go func(t *bundleTool) {
+			defer wg.Done()
+			t.Name = bundleNameRe.ReplaceAllString(name, "")
+			if q.Program == "" {
+				t.Error = "Invalid query"
+				return
+			}
+			result, err := h.execute(q)
+			if err != nil {
+				log.Printf("bundle tool %s failed: %s", name, err)
+				// prevent shell injection
+				t.Error = errMsgRe.ReplaceAllString(err.Error(), "")
+				return
+			}
+			t.QueryResult = result
+			if result.Ambiguous() && !confirm {
+				t.Error = fmt.Sprintf("no repository named %s was found and %s/%s is a weak match (use confirm=1 to install it)",
+					errMsgRe.ReplaceAllString(result.Searched, ""), result.User, result.Program)
+			}
+		}(&tools[i])
+	}
+	wg.Wait()
+	if r.URL.Query().Get("type") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		b, _ := json.MarshalIndent(tools, "", "  ")
+		w.Write(b)
+		return
+	}
+	data := struct {
+		Query
+		Tools   []bundleTool
+		M1Asset bool
+	}{
+		Query: base,
+		Tools: tools,
+		// rosetta fallback is decided per tool
+		M1Asset: true,
+	}
+	t, err := template.New("installer").Parse(string(scripts.Bundle))
+	if err == nil {
+		_, err = t.Parse(string(scripts.Common))
+	}
+	if err != nil {
+		showError("installer BUG: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buff := bytes.Buffer{}
+	if err := t.Execute(&buff, data); err != nil {
+		showError("Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("serving bundle script (%d tools)", len(tools))
+	w.Header().Set("Content-Type", "text/x-shellscript")
+	w.Write(buff.Bytes())
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigBundle(t *testing.T) {
+	c := Config{Bundles: []string{"dev=jq,BurntSushi/ripgrep@14 ops=derailed/k9s", "web=jpillora/serve"}}
+	for name, want := range map[string]string{
+		"dev": "jq,BurntSushi/ripgrep@14",
+		"ops": "derailed/k9s",
+		"web": "jpillora/serve",
+	} {
+		if got, ok := c.bundle(name); !ok || got != want {
+			t.Fatalf("bundle(%s) = %s, want %s", name, got, want)
+		}
+	}
+	if _, ok := c.bundle("jq"); ok {
+		t.Fatalf("expected jq not to be a bundle")
+	}
+}
+
+func TestBundle(t *testing.T) {
+	h := &Handler{
+		Config: Config{Bundles: []string{"dev=acme/foo,acme/bar@v2"}},
+		cache:  map[string]QueryResult{},
+	}
+	for _, q := range []Query{
+		{User: "acme", Program: "foo", Release: "latest", MoveToPath: true, Constraint: true},
+		{User: "acme", Program: "bar", Release: "v2", MoveToPath: true, Constraint: true},
+	} {
+		h.cache[q.cacheKey()] = QueryResult{
+			Query:           q,
+			ResolvedRelease: q.Release,
+			Timestamp:       time.Now(),
+			Assets: Assets{{
+				Name: q.Program + "_darwin_amd64.tar.gz",
+				OS:   "darwin",
+				Arch: "amd64",
+				URL:  "https://github.com/acme/" + q.Program + "/releases/download/v1.2.3/" + q.Program + "_darwin_amd64.tar.gz",
+				Type: ".tar.gz",
+			}},
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/bundle/dev!", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bundle failed: %s", w.Body.String())
+	}
+	for _, want := range []string{`PROG="foo"`, `PROG="bar"`, `OUT_DIR="/usr/local/bin"`, "ARCH=\"amd64\"", `"darwin_amd64")`, "Failed:"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected bundle script to contain %q", want)
+		}
+	}
+	// unresolved tools are reported by the script
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/bundle/acme/foo,acme/baz!", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bundle failed: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `FAILED="$FAILED acme/baz"`) {
+		t.Fatalf("expected acme/baz to fail")
+	}
+}
+
+func TestBundleVersionPrefix(t *testing.T) {
+	asset := ghAsset{
+		Name:               "rg-14.1.1-x86_64-unknown-linux-musl.tar.gz",
+		BrowserDownloadURL: "https://github.com/acme/rg/releases/download/14.1.1/rg-14.1.1-x86_64-unknown-linux-musl.tar.gz",
+		Size:               2 * 1024 * 1024,
+	}
+	stub := githubStub{
+		"/repos/acme/rg/releases": []ghRelease{
+			{TagName: "15.0.0-rc1", Prerelease: true},
+			{TagName: "14.1.1", Assets: []ghAsset{asset}, AssetsURL: "https://api.github.com/repos/acme/rg/releases/2/assets"},
+			{TagName: "14.1.0"},
+		},
+		"/repos/acme/rg/releases/2/assets": []ghAsset{asset},
+	}
+	h := &Handler{Client: &http.Client{Transport: stub}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/bundle/acme/rg@14?type=json", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ResolvedRelease": "14.1.1"`) {
+		t.Fatalf("expected rg@14 to resolve 14.1.1: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// maximum number of assets downloaded at once by a request
+	downloadWorkers = 4
+	// maximum number of assets downloaded at once by the server
+	maxDownloads = 8
+)
+
+// deadline for downloading the assets of a request, downloads are
+// on the request path (checksums and inspections)
+var downloadTimeout = time.Minute
+
+// SRI is the asset checksum in subresource integrity format (nix)
+func (a Asset) SRI() string {
+	b, err := hex.DecodeString(a.SHA256)
+	if err != nil || len(b) != sha256.Size {
+		return ""
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(b)
+}
+
+// assetSHA256 downloads and hashes the asset at url. release assets
+// are immutable, so results are cached for the lifetime of the server.
+func (h *Handler) assetSHA256(ctx context.Context, url string) (string, error) {
+	h.sumsMut.Lock()
+	sum, ok := h.sums[url]
+	h.sumsMut.Unlock()
+	if ok {
+		return sum, nil
+	}
+	body, err := h.download(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hw := sha256.New()
+	if _, err := io.Copy(hw, body); err != nil {
+		return "", err
+	}
+	sum = hex.EncodeToString(hw.Sum(nil))
+	h.sumsMut.Lock()
+	if h.sums == nil {
+		h.sums = map[string]string{}
+	}
+	h.sums[url] = sum
+	h.sumsMut.Unlock()
+	return sum, nil
+}
+
+// withSHA256 returns a copy of assets where missing checksums
+// (no checksum file in the release) have been computed server-side
+func (h *Handler) withSHA256(assets Assets) Assets {
+	filled := make(Assets, len(assets))
+	copy(filled, assets)
+	h.eachAsset(len(filled), func(ctx context.Context, i int) {
+		a := &filled[i]
+		if a.SHA256 != "" {
+			return
+		}
+		sum, err := h.assetSHA256(ctx, a.URL)
+		if err != nil {
+			log.Printf("failed to compute sha256 of %s: %s", a.Name, err)
+			return
+		}
+		a.SHA256 = sum
+	})
+	return filled
+}
+
+// eachAsset calls fn with the index of each of n assets, on a bounded
+// pool of workers. their downloads share the request deadline.
+func (h *Handler) eachAsset(n int, fn func(ctx context.Context, i int)) {
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(n, downloadWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(ctx, i)
+			}
+		}()
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// downloadBody releases its download slot when closed
+type downloadBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b downloadBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSRI(t *testing.T) {
+	a := Asset{SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}
+	if got, want := a.SRI(), "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="; got != want {
+		t.Fatalf("SRI() = %s, want %s", got, want)
+	}
+	if got := (Asset{SHA256: "not-hex"}).SRI(); got != "" {
+		t.Fatalf("expected invalid checksum to have no SRI, got %s", got)
+	}
+}
+
+func TestWithSHA256(t *testing.T) {
+	downloads, active, peak := atomic.Int32{}, atomic.Int32{}, atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		n := active.Add(1)
+		defer active.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+	h := &Handler{Client: srv.Client()}
+	assets := func(prefix string, n int) Assets {
+		as := Assets{}
+		for i := range n {
+			as = append(as, Asset{Name: fmt.Sprint(i), URL: fmt.Sprintf("%s/%s%d", srv.URL, prefix, i)})
+		}
+		return as
+	}
+	// downloads are limited per request and across requests
+	wg := sync.WaitGroup{}
+	for _, prefix := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, a := range h.withSHA256(assets(prefix, 10)) {
+				if a.SHA256 == "" {
+					t.Errorf("expected a checksum: %+v", a)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p > maxDownloads {
+		t.Fatalf("expected at most %d downloads at once, got %d", maxDownloads, p)
+	}
+	// checksums are cached
+	if h.withSHA256(assets("a", 10)); downloads.Load() != 30 {
+		t.Fatalf("expected 30 downloads, got %d", downloads.Load())
+	}
+	// downloads stop at the deadline
+	defer func(d time.Duration) { downloadTimeout = d }(downloadTimeout)
+	downloadTimeout = 100 * time.Millisecond
+	start := time.Now()
+	filled := h.withSHA256(Assets{{Name: "slow", URL: srv.URL + "/slow"}, {Name: "fast", URL: srv.URL + "/fast"}})
+	if time.Since(start) > 5*time.Second || filled[0].SHA256 != "" || filled[1].SHA256 == "" {
+		t.Fatalf("expected the slow download to time out: %+v", filled)
+	}
+}
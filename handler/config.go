@@ -2,12 +2,17 @@ package handler
 
 // Config installer handler
 type Config struct {
-	Host      string `opts:"help=host, env=HTTP_HOST"`
-	Port      int    `opts:"help=port, env"`
-	User      string `opts:"help=default user when not provided in URL, env"`
-	Token     string `opts:"help=github api token, env=GITHUB_TOKEN"`
-	ForceUser string `opts:"help=lock installer to a single user, env=FORCE_USER"`
-	ForceRepo string `opts:"help=lock installer to a single repo, env=FORCE_REPO"`
+	Host       string   `opts:"help=host, env=HTTP_HOST"`
+	Port       int      `opts:"help=port, env"`
+	User       string   `opts:"help=default user when not provided in URL, env"`
+	Token      string   `opts:"help=github api token, env=GITHUB_TOKEN"`
+	ForceUser  string   `opts:"help=lock installer to a single user, env=FORCE_USER"`
+	ForceRepo  string   `opts:"help=lock installer to a single repo, env=FORCE_REPO"`
+	Bundles    []string `opts:"name=bundle, help=named bundle <name>=<queries> served at /bundle/<name>, env=BUNDLES"`
+	Aliases    string   `opts:"help=json file of program aliases which override the defaults, env=ALIASES"`
+	Weights    []string `opts:"name=weight, help=asset scoring rule weight <rule>=<points>, env=WEIGHTS"`
+	Inspect    bool     `opts:"help=download the chosen assets and check the os and arch of their executables, env"`
+	SigningKey string   `opts:"help=unencrypted openssh ed25519 private key file used to sign responses, env=SIGNING_KEY"`
 }
 
 // DefaultConfig for an installer handler
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
@@ -11,8 +12,10 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"text/template"
@@ -30,6 +33,8 @@ var (
 	isHomebrewRe = regexp.MustCompile(`(?i)^homebrew`)
 	errMsgRe     = regexp.MustCompile(`[^A-Za-z0-9\ :\/\.]`)
 	errNotFound  = errors.New("not found")
+	errNoAssets  = errors.New("no assets found")
+	errNoBinary  = errors.New("no downloads found for this release")
 )
 
 type Query struct {
@@ -38,6 +43,30 @@ type Query struct {
 	MoveToPath, Search, Insecure bool
 	SudoMove                     bool   // deprecated: not used, now automatically detected
 	OS, Arch                     string // override OS and Arch
+	Action                       string // install (default), upgrade or uninstall
+	Force                        bool   // reinstall even when already installed
+	Dir                          string // install directory, overrides MoveToPath
+	Stage                        bool   // dockerfile as a build stage
+	Bin                          string // binary name inside the release asset, defaults to the largest file
+	Unquarantine                 bool   // remove the macOS gatekeeper quarantine attribute
+	FromSource                   bool   // build from source when the release has no binary assets
+	Constraint                   bool   // release is a version prefix (lock queries), v1.9 matches v1.9.8
+}
+
+// OutDir is the install directory as a shell expression
+func (q Query) OutDir() string {
+	switch {
+	case q.Dir == "~":
+		return "$HOME"
+	case strings.HasPrefix(q.Dir, "~/"):
+		return "$HOME" + strings.TrimPrefix(q.Dir, "~")
+	case q.Dir != "":
+		return q.Dir
+	case q.MoveToPath:
+		return "/usr/local/bin"
+	default:
+		return "$(pwd)"
+	}
 }
 
 type QueryResult struct {
@@ -46,6 +75,41 @@ type QueryResult struct {
 	Timestamp       time.Time
 	Assets          Assets
 	M1Asset         bool
+	Searched        string            `json:",omitempty"` // program name which was searched for
+	Candidates      []SearchCandidate `json:",omitempty"` // search results, when the search match is weak
+	Scores          []AssetScore      `json:",omitempty"` // asset score breakdown, shown with debug=1
+	Source          *Source           `json:",omitempty"` // source build, when the release has no binary assets
+}
+
+// Ambiguous reports whether the program was found
+// with a weak search match (see searchAssets)
+func (r QueryResult) Ambiguous() bool {
+	return len(r.Candidates) > 0
+}
+
+// ProgramName is the name of the installed binary
+func (q Query) ProgramName() string {
+	if q.AsProgram != "" {
+		return q.AsProgram
+	}
+	return q.Program
+}
+
+// StageName is the dockerfile build stage name of the program,
+// which may only contain lower case letters, digits, "-", "_" and "."
+func (q Query) StageName() string {
+	return stageNameRe.ReplaceAllString(strings.ToLower(q.ProgramName()), "-")
+}
+
+// Version is the resolved release without the "v" prefix
+func (r QueryResult) Version() string {
+	return strings.TrimPrefix(r.ResolvedRelease, "v")
+}
+
+// FormulaClass is the homebrew class name of the program,
+// homebrew requires it to match the formula file name
+func (r QueryResult) FormulaClass() string {
+	return formulaClass(r.Program)
 }
 
 func (q Query) cacheKey() string {
@@ -57,24 +121,124 @@ func (q Query) cacheKey() string {
 	return base64.StdEncoding.EncodeToString(hw.Sum(nil))
 }
 
+// routeQuery sets the user, program and release of q from
+// a <user>/<repo>@<release> (or <query>) route
+func (h *Handler) routeQuery(q Query, path string) Query {
+	var rest string
+	q.User, rest = splitHalf(path, "/")
+	q.Program, q.Release = splitHalf(rest, "@")
+	// no program? treat first part as program, use
+	// the alias registry, otherwise the default user
+	if q.Program == "" {
+		q.Program, q.Release = splitHalf(q.User, "@")
+		q.User = h.Config.User
+		if aliased, ok := h.applyAlias(q); ok {
+			q = aliased
+		} else {
+			q.Search = true
+		}
+	}
+	if q.Release == "" {
+		q.Release = "latest"
+	}
+	// force user/repo
+	if h.Config.ForceUser != "" {
+		q.User = h.Config.ForceUser
+	}
+	if h.Config.ForceRepo != "" {
+		q.Program = h.Config.ForceRepo
+	}
+	return q
+}
+
+// installDir is the custom install directory, set with dir, prefix or user
+func installDir(v url.Values) (string, error) {
+	dir := v.Get("dir")
+	if prefix := v.Get("prefix"); dir == "" && prefix != "" {
+		dir = strings.TrimRight(prefix, "/") + "/bin"
+	}
+	if dir == "" && v.Get("user") == "1" {
+		dir = "~/.local/bin"
+	}
+	// prevent shell injection, the directory is embedded in the script
+	if dir != "" && !isSafeDir(dir) {
+		return "", errors.New("Invalid directory")
+	}
+	return dir, nil
+}
+
 // Handler serves install scripts using Github releases
 type Handler struct {
 	Config
-	Client   *http.Client
-	cacheMut sync.Mutex
-	cache    map[string]QueryResult
+	Client         *http.Client
+	Searchers      []Searcher       // defaults to github search, then web search
+	Aliases        map[string]Alias // defaults to the embedded registry (see LoadAliases)
+	Weights        Weights          // asset scoring rules, defaults to DefaultWeights
+	Signer         *Signer          // signs responses, when set (see LoadSigner)
+	cacheMut       sync.Mutex
+	cache          map[string]QueryResult
+	sumsMut        sync.Mutex
+	sums           map[string]string
+	inspectMut     sync.Mutex
+	inspections    map[string]inspection
+	downloadsOnce  sync.Once
+	downloads      chan struct{}
+	locksMut       sync.Mutex
+	locks          map[string]lockEntry
+	searchMut      sync.Mutex
+	searches       map[string]searchEntry
+	aliasOnce      sync.Once
+	defaultAliases map[string]Alias
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// signed responses
+	if h.Signer != nil {
+		h.serveSigned(w, r)
+		return
+	}
+	h.serve(w, r)
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/healthz" || r.URL.Path == "/favicon.ico" {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 		return
 	}
+	if r.URL.Path == "/aliases" {
+		h.serveAliases(w)
+		return
+	}
+	// script signature verification
+	if r.URL.Path == "/verify" || r.URL.Path == "/signing-key.pub" {
+		h.serveVerify(w, r)
+		return
+	}
+	// multiple tools in a single script
+	if strings.HasPrefix(r.URL.Path, "/bundle/") {
+		h.serveBundle(w, r)
+		return
+	}
+	// lockfiles
+	if r.URL.Path == "/lock" && r.Method == http.MethodPost {
+		h.serveLock(w, r)
+		return
+	}
+	if r.URL.Path == "/install" && (r.Method == http.MethodPost || r.URL.Query().Has("lock")) {
+		h.serveLockInstall(w, r)
+		return
+	}
 	// calculate response type
 	ext := ""
 	script := ""
+	sums := false
 	qtype := r.URL.Query().Get("type")
+	// file style routes, e.g. /user/repo.rb
+	urlPath, ftype := trimFileSuffix(r.URL.Path)
+	if qtype == "" {
+		qtype = ftype
+	}
 	if qtype == "" {
 		ua := r.Header.Get("User-Agent")
 		switch {
@@ -86,11 +250,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			qtype = "text"
 		}
 	}
+	// piped into sh instead of bash
+	if qtype == "script" && r.URL.Query().Get("shell") == "sh" {
+		qtype = "sh"
+	}
 	// type specific error response
 	showError := func(msg string, code int) {
 		// prevent shell injection
 		cleaned := errMsgRe.ReplaceAllString(msg, "")
-		if qtype == "script" {
+		if qtype == "script" || qtype == "sh" {
 			cleaned = fmt.Sprintf("echo '%s'", cleaned)
 		}
 		http.Error(w, cleaned, http.StatusInternalServerError)
@@ -104,10 +272,50 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/x-shellscript")
 		ext = "sh"
 		script = string(scripts.Shell)
+	case "sh":
+		w.Header().Set("Content-Type", "text/x-shellscript")
+		ext = "sh"
+		script = string(scripts.POSIXShell)
 	case "homebrew", "ruby":
 		w.Header().Set("Content-Type", "text/ruby")
 		ext = "rb"
 		script = string(scripts.Homebrew)
+		sums = true
+	case "nix":
+		w.Header().Set("Content-Type", "text/plain")
+		ext = "nix"
+		script = string(scripts.Nix)
+		sums = true
+	case "dockerfile":
+		w.Header().Set("Content-Type", "text/plain")
+		ext = "dockerfile"
+		script = string(scripts.Dockerfile)
+		sums = true
+	case "action":
+		w.Header().Set("Content-Type", "text/yaml")
+		ext = "yml"
+		script = string(scripts.Action)
+		sums = true
+	case "ansible":
+		w.Header().Set("Content-Type", "text/yaml")
+		ext = "yml"
+		script = string(scripts.Ansible)
+		sums = true
+	case "cloud-init":
+		w.Header().Set("Content-Type", "text/cloud-config")
+		ext = "yml"
+		script = string(scripts.CloudInit)
+		sums = true
+	case "lock":
+		w.Header().Set("Content-Type", "application/json")
+		ext = "json"
+		script = ""
+		sums = true
+	case "scoop":
+		w.Header().Set("Content-Type", "application/json")
+		ext = "json"
+		script = ""
+		sums = true
 	case "text":
 		w.Header().Set("Content-Type", "text/plain")
 		ext = "txt"
@@ -125,9 +333,38 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Select:    r.URL.Query().Get("select"),
 		OS:        r.URL.Query().Get("os"),
 		Arch:      r.URL.Query().Get("arch"),
+		Action:    r.URL.Query().Get("action"),
+		Force:     r.URL.Query().Get("force") == "1",
+		Stage:     r.URL.Query().Get("stage") == "1",
+		Bin:       r.URL.Query().Get("bin"),
+
+		Unquarantine: r.URL.Query().Get("unquarantine") == "1",
+		FromSource:   r.URL.Query().Get("source") == "1",
+	}
+	switch q.Action {
+	case "", "install", "upgrade", "uninstall":
+		// valid
+	default:
+		showError("Unknown action", http.StatusBadRequest)
+		return
 	}
+	// prevent shell injection, the binary names are embedded in the script
+	if q.Bin != "" && !binNameRe.MatchString(q.Bin) {
+		showError("Invalid bin", http.StatusBadRequest)
+		return
+	}
+	if q.AsProgram != "" && !binNameRe.MatchString(q.AsProgram) {
+		showError("Invalid as", http.StatusBadRequest)
+		return
+	}
+	dir, err := installDir(r.URL.Query())
+	if err != nil {
+		showError(err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Dir = dir
 	// set query from route
-	path := strings.TrimPrefix(r.URL.Path, "/")
+	path := strings.TrimPrefix(urlPath, "/")
 	// move to path with !
 	if strings.HasSuffix(path, "!") {
 		q.MoveToPath = true
@@ -136,29 +373,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Query().Get("move") == "1" {
 		q.MoveToPath = true // also allow move=1 if bang in urls cause issues
 	}
-	var rest string
-	q.User, rest = splitHalf(path, "/")
-	q.Program, q.Release = splitHalf(rest, "@")
-	// no program? treat first part as program, use default user
-	if q.Program == "" {
-		q.Program = q.User
-		q.User = h.Config.User
-		q.Search = true
-	}
-	if q.Release == "" {
-		q.Release = "latest"
-	}
-	// micro > nano!
-	if q.User == "" && q.Program == "micro" {
-		q.User = "zyedidia"
-	}
-	// force user/repo
-	if h.Config.ForceUser != "" {
-		q.User = h.Config.ForceUser
-	}
-	if h.Config.ForceRepo != "" {
-		q.Program = h.Config.ForceRepo
-	}
+	q = h.routeQuery(q, path)
+	// lock releases may be version constraints
+	q.Constraint = qtype == "lock"
 	// validate query
 	valid := q.Program != ""
 	if !valid && path == "" {
@@ -176,6 +393,57 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		showError(err.Error(), http.StatusBadGateway)
 		return
 	}
+	// asset score breakdown, for debugging
+	if r.URL.Query().Get("debug") != "1" {
+		result.Scores = nil
+	}
+	// weak search match, refuse to auto-install unless confirmed
+	if (qtype == "script" || qtype == "sh") && result.Ambiguous() && r.URL.Query().Get("confirm") != "1" {
+		log.Printf("refusing ambiguous search for %s (found %s/%s)", result.Searched, result.User, result.Program)
+		w.Write([]byte(ambiguousScript(result)))
+		return
+	}
+	// no release binaries, only the install scripts can build from source
+	if result.Source != nil {
+		switch qtype {
+		case "script", "sh":
+			script = string(scripts.Source)
+		case "json", "text":
+			// labelled as a source build
+		default:
+			showError("No release binaries: source builds are only available as install scripts", http.StatusNotFound)
+			return
+		}
+	}
+	// formats which require a checksum for every asset, these can't detect
+	// the host libc or install macOS disk images and packages, so use the
+	// most portable extractable asset of each platform
+	if sums {
+		result.Assets = h.withSHA256(result.Assets.Extractable().Primary())
+		result.M1Asset = result.Assets.HasM1()
+	}
+	// scoop manifests are json with hashes, pointing back at this server
+	if qtype == "scoop" {
+		m, err := newScoopManifest(result, baseURL(r))
+		if err != nil {
+			showError(err.Error(), http.StatusNotFound)
+			return
+		}
+		b, _ := json.MarshalIndent(m, "", "  ")
+		w.Write(b)
+		return
+	}
+	// single tool lockfile
+	if qtype == "lock" {
+		query := result.User + "/" + result.Program + "@" + result.Release
+		t, err := newLockTool(query, result)
+		if err != nil {
+			showError(err.Error(), http.StatusBadGateway)
+			return
+		}
+		h.writeLock(w, Lock{Version: lockVersion, Tools: []LockTool{t}})
+		return
+	}
 	// no render script? just output as json
 	if script == "" {
 		b, _ := json.MarshalIndent(result, "", "  ")
@@ -184,6 +452,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	// load template
 	t, err := template.New("installer").Parse(script)
+	if err == nil {
+		_, err = t.Parse(string(scripts.Common))
+	}
 	if err != nil {
 		showError("installer BUG: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -201,12 +472,59 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 type Asset struct {
 	Name, OS, Arch, URL, Type, SHA256 string
+	Variant                           string `json:",omitempty"` // sub-architecture, arm: v5, v6 or v7, amd64: v2, v3 or v4
+	Libc                              string `json:",omitempty"` // linux only: gnu, musl or unknown (static)
+	Alternatives                      Assets `json:",omitempty"` // other file types for this platform, by score
+	BinPath                           string `json:",omitempty"` // executable inside the asset, when inspected (see Config.Inspect)
 }
 
 func (a Asset) Key() string {
 	return a.OS + "/" + a.Arch
 }
 
+// Platform identifies the asset variant in install scripts (e.g. linux_arm_v7_musl),
+// which try the variants in order of compatibility with the host
+func (a Asset) Platform() string {
+	p := a.OS + "_" + a.Arch
+	if a.Variant != "" {
+		p += "_" + a.Variant
+	}
+	if a.Libc != "" {
+		p += "_" + a.Libc
+	}
+	return p
+}
+
+// NixSystem is the nix system double of the asset (e.g. x86_64-linux)
+func (a Asset) NixSystem() string {
+	return nixSystems[a.Key()]
+}
+
+// NixInputs are the nix packages required to extract the assets
+func (as Assets) NixInputs() []string {
+	inputs := []string{}
+	for _, a := range as {
+		if pkg, ok := nixInputs[a.Type]; ok && a.NixSystem() != "" && !slices.Contains(inputs, pkg) {
+			inputs = append(inputs, pkg)
+		}
+	}
+	return inputs
+}
+
+// AnsibleKeys are the ansible_system/ansible_architecture
+// fact pairs matching the asset (e.g. Linux/x86_64)
+func (a Asset) AnsibleKeys() []string {
+	system, ok := ansibleSystems[a.OS]
+	if !ok {
+		return nil
+	}
+	keys := []string{}
+	for _, arch := range ansibleArchs[a.Arch] {
+		keys = append(keys, system+"/"+arch)
+	}
+	return keys
+}
+
 func (a Asset) Is32Bit() bool {
 	return a.Arch == "386"
 }
@@ -231,6 +549,74 @@ func (as Assets) HasM1() bool {
 	return false
 }
 
+// Primary returns the first (most portable) asset of each os/arch,
+// used by formats which can't choose a variant or file type on the host
+func (as Assets) Primary() Assets {
+	seen := map[string]bool{}
+	primary := Assets{}
+	for _, a := range as {
+		if !seen[a.Key()] {
+			seen[a.Key()] = true
+			a.Alternatives = nil
+			primary = append(primary, a)
+		}
+	}
+	return primary
+}
+
+// Extractable replaces the macOS disk images and installer packages, which
+// only the install scripts can install, with the next best file type of
+// their platform (see Asset.Alternatives), dropping them when there is none
+func (as Assets) Extractable() Assets {
+	extractable := Assets{}
+	for _, a := range as {
+		if a.Type == ".dmg" || a.Type == ".pkg" {
+			i := slices.IndexFunc(a.Alternatives, func(alt Asset) bool {
+				return alt.Type != ".dmg" && alt.Type != ".pkg"
+			})
+			if i == -1 {
+				continue
+			}
+			a = a.Alternatives[i]
+		}
+		extractable = append(extractable, a)
+	}
+	return extractable
+}
+
+// BinPaths are the known binary paths inside the assets (see Asset.BinPath),
+// used by formats which extract the asset without knowing which one it is
+func (as Assets) BinPaths() []string {
+	paths := []string{}
+	for _, a := range as {
+		if a.BinPath != "" && !slices.Contains(paths, a.BinPath) {
+			paths = append(paths, a.BinPath)
+		}
+	}
+	return paths
+}
+
+func (as Assets) hasType(t string) bool {
+	for _, a := range as {
+		if a.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// First returns the first asset found for the given keys (os/arch)
+func (as Assets) First(keys ...string) *Asset {
+	for _, k := range keys {
+		for _, a := range as {
+			if a.Key() == k {
+				return &a
+			}
+		}
+	}
+	return nil
+}
+
 func (h *Handler) get(url string, v any) error {
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
@@ -238,13 +624,9 @@ func (h *Handler) get(url string, v any) error {
 		req.Header.Set("Authorization", "token "+h.Config.Token)
 	}
 
-	client := h.Client
-	if client == nil {
-		// Check if we're in testing mode without RECORD=1
-		if flag.Lookup("test.v") != nil && os.Getenv("RECORD") != "1" {
-			return fmt.Errorf("attempted real HTTP request during testing without RECORD=1: %s", url)
-		}
-		client = http.DefaultClient
+	client, err := h.httpClient(url)
+	if err != nil {
+		return err
 	}
 
 	resp, err := client.Do(req)
@@ -265,3 +647,61 @@ func (h *Handler) get(url string, v any) error {
 	}
 	return nil
 }
+
+// baseURL is the public URL of this installer server
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// download fetches a release asset, the caller must close the body
+// download the asset at url, once one of the server's download slots
+// is free. the slot is released when the body is closed.
+func (h *Handler) download(ctx context.Context, url string) (io.ReadCloser, error) {
+	client, err := h.httpClient(url)
+	if err != nil {
+		return nil, err
+	}
+	h.downloadsOnce.Do(func() {
+		h.downloads = make(chan struct{}, maxDownloads)
+	})
+	select {
+	case h.downloads <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("download cancelled: %s: %s", url, ctx.Err())
+	}
+	release := func() { <-h.downloads }
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("request failed: %s: %s", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		release()
+		return nil, fmt.Errorf("download failed: %s: %s", url, resp.Status)
+	}
+	return downloadBody{ReadCloser: resp.Body, release: release}, nil
+}
+
+func (h *Handler) httpClient(url string) (*http.Client, error) {
+	if h.Client != nil {
+		return h.Client, nil
+	}
+	// Check if we're in testing mode without RECORD=1
+	if flag.Lookup("test.v") != nil && os.Getenv("RECORD") != "1" {
+		return nil, fmt.Errorf("attempted real HTTP request during testing without RECORD=1: %s", url)
+	}
+	return http.DefaultClient, nil
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 )
@@ -26,42 +25,39 @@ func (h *Handler) execute(q Query) (QueryResult, error) {
 	}
 	// do real operation
 	ts := time.Now()
-	release, assets, err := h.getAssetsNoCache(q)
+	result := QueryResult{Query: q}
+	var err error
+	result.ResolvedRelease, result.Assets, result.Scores, err = h.getAssetsNoCache(q)
 	if err == nil {
 		// didn't need search
-		q.Search = false
+		result.Search = false
 	} else if errors.Is(err, errNotFound) && q.Search {
-		// use ddg/google to auto-detect user...
-		user, program, gerr := imFeelingLuck(q.Program)
-		if gerr != nil {
-			log.Printf("web search failed: %s", gerr)
-		} else {
-			log.Printf("web search found: %s/%s", user, program)
-			if program != q.Program {
-				log.Printf("program mismatch: got %s: expected %s", q.Program, program)
-			}
-			q.Program = program
-			q.User = user
-			// retry assets...
-			release, assets, err = h.getAssetsNoCache(q)
-		}
+		// search for the repo to auto-detect user...
+		result, err = h.searchAssets(q)
+		result.Searched = q.Program
+	} else if q.FromSource && (errors.Is(err, errNoAssets) || errors.Is(err, errNoBinary)) {
+		// no binaries, build from source instead
+		result.Search = false
+		result.Source, err = h.getSource(q, result.ResolvedRelease)
 	}
 	// asset fetch failed, dont cache
 	if err != nil {
 		return QueryResult{}, err
 	}
 	// success
-	if q.Release == "" && release != "" {
-		log.Printf("detected release: %s", release)
-		q.Release = release
+	if result.Release == "" && result.ResolvedRelease != "" {
+		log.Printf("detected release: %s", result.ResolvedRelease)
+		result.Release = result.ResolvedRelease
 	}
-	result := QueryResult{
-		Timestamp:       ts,
-		Query:           q,
-		ResolvedRelease: release,
-		Assets:          assets,
-		M1Asset:         assets.HasM1(),
+	// confirm the os/arch of each asset using its executable headers
+	if h.Config.Inspect && result.Source == nil {
+		result.Assets = h.inspectAssets(result.Query, result.Assets)
+		if len(result.Assets) == 0 {
+			return QueryResult{}, errors.New("no executables found in the release assets")
+		}
 	}
+	result.Timestamp = ts
+	result.M1Asset = result.Assets.HasM1()
 	// success store results
 	h.cacheMut.Lock()
 	h.cache[key] = result
@@ -69,7 +65,7 @@ func (h *Handler) execute(q Query) (QueryResult, error) {
 	return result, nil
 }
 
-func (h *Handler) getAssetsNoCache(q Query) (string, Assets, error) {
+func (h *Handler) getAssetsNoCache(q Query) (string, Assets, []AssetScore, error) {
 	user := q.User
 	repo := q.Program
 	release := q.Release
@@ -81,157 +77,64 @@ func (h *Handler) getAssetsNoCache(q Query) (string, Assets, error) {
 		url += "/latest"
 		ghr := ghRelease{}
 		if err := h.get(url, &ghr); err != nil {
-			return release, nil, err
+			return release, nil, nil, err
 		}
 		release = ghr.TagName // discovered
 		ghas = ghr.Assets
 	} else {
 		ghrs := []ghRelease{}
 		if err := h.get(url, &ghrs); err != nil {
-			return release, nil, err
+			return release, nil, nil, err
 		}
-		found := false
-		for _, ghr := range ghrs {
+		// exact tag, otherwise for version constraints, the newest stable
+		// release matching the prefix (releases are listed newest first,
+		// only the first page is searched)
+		var found *ghRelease
+		for i, ghr := range ghrs {
 			if ghr.TagName == release {
-				found = true
-				if err := h.get(ghr.AssetsURL, &ghas); err != nil {
-					return release, nil, err
-				}
-				ghas = ghr.Assets
+				found = &ghrs[i]
 				break
 			}
 		}
-		if !found {
-			return release, nil, fmt.Errorf("release tag '%s' not found", release)
+		if found == nil && q.Constraint {
+			for i, ghr := range ghrs {
+				if !ghr.Draft && !ghr.Prerelease && matchesRelease(ghr.TagName, release) {
+					found = &ghrs[i]
+					break
+				}
+			}
+		}
+		if found == nil {
+			return release, nil, nil, fmt.Errorf("release tag '%s' not found", release)
 		}
+		release = found.TagName // discovered
+		if err := h.get(found.AssetsURL, &ghas); err != nil {
+			return release, nil, nil, err
+		}
+		ghas = found.Assets
 	}
 	if len(ghas) == 0 {
-		return release, nil, errors.New("no assets found")
+		return release, nil, nil, errNoAssets
 	}
 	sumIndex, _ := ghas.getSumIndex()
 	if l := len(sumIndex); l > 0 {
 		log.Printf("fetched %d asset shasums", l)
 	}
 
-	var (
-		candidates      = map[string]Asset{}
-		index           = map[string]Asset{}
-		foundLinuxAMD64 = false
-	)
-	for _, ga := range ghas {
-		url := ga.BrowserDownloadURL
-		// only binary containers are supported
-		// TODO deb,rpm etc
-		fext := getFileExt(url)
-		if fext == "" && ga.Size > 1024*1024 {
-			fext = ".bin" // +1MB binary
-		}
-		switch fext {
-		case ".bin", ".zip", ".tar.bz", ".tar.bz2", ".tar.xz", ".txz", ".bz2", ".gz", ".tar.gz", ".tgz":
-			// valid
-		default:
-			log.Printf("fetched asset has unsupported file type: %s (ext '%s')", ga.Name, fext)
-			continue
-		}
-		// match
-		os := getOS(ga.Name)
-		arch := getArch(ga.Name)
-		// windows not supported yet
-		if os == "windows" {
-			log.Printf("fetched asset is for windows: %s", ga.Name)
-			// TODO: powershell
-			// EG: iwr https://deno.land/x/install/install.ps1 -useb | iex
-			continue
-		}
-
-		// stop guessing for linux/amd64 assets when the exact match is found
-		if os == "linux" && arch == "amd64" {
-			foundLinuxAMD64 = true
-		}
-		assumedLinuxAsset := false
-		// unknown arch/os, the asset will be regarded as linux/amd64 if no other assets match
-		if os == "" {
-			assumedLinuxAsset = true
-			if arch == "" || arch == "amd64" {
-				if foundLinuxAMD64 {
-					continue
-				}
-			}
-		}
-		if arch == "" {
-			arch = "amd64"
-			if os == "linux" {
-				assumedLinuxAsset = true
-			}
-		}
-
-		// user selecting a particular asset?
-		if q.Select != "" && !strings.Contains(ga.Name, q.Select) {
-			log.Printf("select excludes asset: %s", ga.Name)
-			continue
-		}
-		asset := Asset{
-			OS:     os,
-			Arch:   arch,
-			Name:   ga.Name,
-			URL:    url,
-			Type:   fext,
-			SHA256: sumIndex[ga.Name],
-		}
-
-		key := asset.Key()
-		// "linux/", "/amd64" will all be assumed as "linux/amd64"
-		if assumedLinuxAsset {
-			// "linux/" always win.
-			if key == "linux/" {
-				delete(candidates, "/amd64")
-				foundLinuxAMD64 = true
-
-				// If key "linux/" exist,
-				// assets like "unknown-os-i386" would be ignored (stop guessing OS)
-			} else if _, exists := candidates["linux/"]; exists {
-				continue
-			}
-			candidates[key] = asset
-			continue
-		}
-
-		// there can only be 1 file for each OS/Arch
-		if other, exists := index[key]; exists {
-			gnu := func(s string) bool { return strings.Contains(s, "gnu") }
-			musl := func(s string) bool { return strings.Contains(s, "musl") }
-			g2m := gnu(other.Name) && !musl(other.Name) && !gnu(asset.Name) && musl(asset.Name)
-			// prefer musl over glib for portability, override with select=gnu
-			if !g2m {
-				continue
-			}
-		}
-		index[key] = asset
+	// release metadata describing each asset
+	hints := h.getHints(q, release, ghas)
+	if l := len(hints); l > 0 {
+		log.Printf("fetched %d asset hints", l)
 	}
 
-	for _, cAsset := range candidates {
-		// "/loong64" will be assumed to be "linux/loong64"
-		if cAsset.OS == "" {
-			cAsset.OS = "linux"
-		}
-		indexKey := cAsset.Key()
-		// and will only be selected if the exact match failed
-		if _, exists := index[indexKey]; !exists {
-			index[indexKey] = cAsset
-		}
-	}
-	if len(index) == 0 {
-		return release, nil, errors.New("no downloads found for this release")
+	assets, scores := h.weights().match(q, ghas, sumIndex, hints)
+	if len(assets) == 0 {
+		return release, nil, scores, errNoBinary
 	}
-	assets := Assets{}
-	for _, a := range index {
-		log.Printf("including asset: %s (%s)", a.Name, a.Key())
-		assets = append(assets, a)
+	for _, a := range assets {
+		log.Printf("including asset: %s (%s)", a.Name, a.Platform())
 	}
-	sort.Slice(assets, func(i, j int) bool {
-		return assets[i].Key() < assets[j].Key()
-	})
-	return release, assets, nil
+	return release, assets, scores, nil
 }
 
 type ghAssets []ghAsset
@@ -114,11 +114,22 @@ func TestUV(t *testing.T) {
 		"linux/arm64":   "uv-aarch64-unknown-linux-musl.tar.gz",
 		"darwin/amd64":  "uv-x86_64-apple-darwin.tar.gz",
 		"darwin/arm64":  "uv-aarch64-apple-darwin.tar.gz",
-		// "windows/amd64": "uv-x86_64-pc-windows-msvc.zip",
-		// "windows/arm64": "uv-aarch64-pc-windows-msvc.zip",
-		// "windows/386":   "uv-i686-pc-windows-msvc.zip",
+		"windows/amd64": "uv-x86_64-pc-windows-msvc.zip",
+		"windows/arm64": "uv-aarch64-pc-windows-msvc.zip",
+		"windows/386":   "uv-i686-pc-windows-msvc.zip",
 	}
 	batchCheckAssets(t, w, testCases)
+
+	// the script chooses between libc variants
+	w, err = makeTestRequest(t, "GET", "/astral-sh/uv@0.8.17?type=script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"linux_amd64_musl")`, `"linux_amd64_gnu")`, `LIBC="musl"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected script to contain %q", want)
+		}
+	}
 }
 
 // mac
@@ -136,6 +147,10 @@ func TestGitui(t *testing.T) {
 		"linux/arm64": "gitui-linux-aarch64.tar.gz",
 	}
 	batchCheckAssets(t, w, testCases)
+	// version prefixes are only matched for lockfiles
+	if _, err := makeTestRequest(t, "GET", "/gitui-org/gitui@v0.27?type=json"); err == nil {
+		t.Fatalf("expected v0.27 not to match release v0.27.0")
+	}
 }
 
 // x32, x64, armv6
@@ -154,6 +169,17 @@ func TestGitleaks(t *testing.T) {
 		"linux/arm64":  "gitleaks_8.28.0_linux_arm64.tar.gz",
 	}
 	batchCheckAssets(t, w, testCases)
+
+	// the script chooses between arm variants
+	w, err = makeTestRequest(t, "GET", "/gitleaks/gitleaks@v8.28.0?type=script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"linux_arm_v6")`, `"linux_arm_v7")`, `VARIANTS="v7 v6 v5 none"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected script to contain %q", want)
+		}
+	}
 }
 
 // macos, dragonflybsd, freebsd, netbsd, openbsd
@@ -262,11 +288,11 @@ func TestYtDlp(t *testing.T) {
 	}
 
 	testCases := map[string]string{
-		// not ideal, but good enough
+		// bare binaries score above zips, musl builds first
 		"darwin/amd64": "yt-dlp_macos",
-		"linux/amd64":  "yt-dlp_musllinux.zip",
+		"linux/amd64":  "yt-dlp_musllinux",
 		"linux/arm":    "yt-dlp_linux_armv7l.zip",
-		"linux/arm64":  "yt-dlp_linux_aarch64",
+		"linux/arm64":  "yt-dlp_musllinux_aarch64",
 	}
 	batchCheckAssets(t, w, testCases)
 }
@@ -278,6 +304,138 @@ func TestJPilloraServe(t *testing.T) {
 	}
 
 	checkAsset(t, w, "linux/amd64", "serve_1.9.8_linux_amd64.gz")
+
+	// receipt based actions are passed through to the script
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve?type=script&action=upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), `ACTION="upgrade"`) {
+		t.Fatal("expected script to contain the upgrade action")
+	}
+	if _, err := makeTestRequest(t, "GET", "/jpillora/serve?type=script&action=bogus"); err == nil {
+		t.Fatal("expected unknown action to fail")
+	}
+	// posix sh variant
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve?type=script&shell=sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(w.Body.String(), "#!/bin/sh\n") {
+		t.Fatal("expected a posix sh script")
+	}
+	// installed programs are skipped unless forced
+	for target, guard := range map[string]string{
+		"/jpillora/serve?type=script":          `[[ $FORCE != "true" ]] && is_installed`,
+		"/jpillora/serve?type=script&shell=sh": `[ "$FORCE" != "true" ] && is_installed`,
+	} {
+		w, err = makeTestRequest(t, "GET", target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if script := w.Body.String(); !strings.Contains(script, `FORCE=""`) || !strings.Contains(script, guard) {
+			t.Fatalf("%s: expected an unforced script with the installed check", target)
+		}
+		w, err = makeTestRequest(t, "GET", target+"&force=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(w.Body.String(), `FORCE="true"`) {
+			t.Fatalf("%s: expected a forced script", target)
+		}
+	}
+	// homebrew formula route
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve.rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formula := w.Body.String()
+	for _, want := range []string{"class Serve < Formula", "on_macos do", "on_linux do", `version "1.9.8"`} {
+		if !strings.Contains(formula, want) {
+			t.Fatalf("expected formula to contain %q", want)
+		}
+	}
+	// scoop manifest from windows assets
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		Version      string
+		Architecture map[string]struct{ URL, Bin string }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != "1.9.8" {
+		t.Fatalf("expected scoop version 1.9.8, got %q", manifest.Version)
+	}
+	if url := manifest.Architecture["64bit"].URL; !strings.Contains(url, "serve_1.9.8_windows_amd64.gz") {
+		t.Fatalf("unexpected scoop 64bit url %q", url)
+	}
+	// nix expression keyed by system
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve.nix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"x86_64-linux" = {`, `"aarch64-darwin" = {`, `pname = "serve";`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected nix expression to contain %q", want)
+		}
+	}
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve?type=dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ARG TARGETARCH", "      linux/amd64) URL=", "sha256sum -c"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected dockerfile to contain %q", want)
+		}
+	}
+	if strings.Contains(w.Body.String(), "FROM ") {
+		t.Fatalf("expected dockerfile snippet without a stage")
+	}
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve?type=dockerfile&stage=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), "FROM scratch AS serve\n") {
+		t.Fatalf("expected dockerfile stage named serve")
+	}
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve/action.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"using: composite", `linux/amd64) URL=`, `>> "$GITHUB_PATH"`, "${{ steps.install.outputs.path }}"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected action to contain %q", want)
+		}
+	}
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve?type=ansible")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Linux/x86_64": { url: "https://`, `"Darwin/arm64": {`, "ansible.builtin.get_url:", "ansible.builtin.unarchive:"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected ansible tasks to contain %q", want)
+		}
+	}
+	w, err = makeTestRequest(t, "GET", "/jpillora/serve?type=cloud-init&dir=/opt/bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(w.Body.String(), "#cloud-config\n") {
+		t.Fatalf("expected cloud-config document")
+	}
+	if !strings.Contains(w.Body.String(), `mv "$BIN" "/opt/bin/serve"`) {
+		t.Fatalf("expected cloud-config to install into /opt/bin")
+	}
+	// the binary name is embedded in every format
+	for _, qtype := range []string{"dockerfile", "ansible", "cloud-init", "script"} {
+		if _, err := makeTestRequest(t, "GET", "/jpillora/serve?type="+qtype+"&as=serve%3Bid"); err == nil {
+			t.Fatalf("%s: expected invalid as to fail", qtype)
+		}
+	}
 }
 
 func TestMicro(t *testing.T) {
@@ -368,7 +526,7 @@ func TestProtoc(t *testing.T) {
 	}
 
 	testCases := map[string]string{
-		"darwin/amd64":  "protoc-33.1-osx-universal_binary.zip",
+		"darwin/amd64":  "protoc-33.1-osx-x86_64.zip", // universal_binary arch is only guessed
 		"darwin/arm64":  "protoc-33.1-osx-aarch_64.zip",
 		"linux/amd64":   "protoc-33.1-linux-x86_64.zip",
 		"linux/386":     "protoc-33.1-linux-x86_32.zip",
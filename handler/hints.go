@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxMetadataSize of release metadata assets (goreleaser artifacts.json)
+const maxMetadataSize = 1 << 20
+
+// assetHint is the platform of a release asset and the binary inside
+// it, as described by release metadata (cargo-binstall or goreleaser)
+type assetHint struct {
+	OS, Arch, Variant, Libc string
+	BinPath                 string // executable inside the asset
+	SHA256                  string
+	From                    string // binstall or goreleaser
+}
+
+// assetHints are indexed by asset name
+type assetHints map[string]assetHint
+
+// getHints reads the release metadata, preferring goreleaser's
+// artifacts.json, then the cargo-binstall metadata in Cargo.toml
+func (h *Handler) getHints(q Query, tag string, ghas ghAssets) assetHints {
+	for _, ga := range ghas {
+		if ga.Name != "artifacts.json" || ga.Size > maxMetadataSize {
+			continue
+		}
+		artifacts := []goreleaserArtifact{}
+		if err := h.get(ga.BrowserDownloadURL, &artifacts); err != nil {
+			log.Printf("goreleaser metadata failed: %s", err)
+			break
+		}
+		if hints := goreleaserHints(q, artifacts, ghas); len(hints) > 0 {
+			return hints
+		}
+	}
+	// only rust projects are checked, to save an api request
+	rust := false
+	for _, ga := range ghas {
+		if rustTargetRe.MatchString(ga.Name) {
+			rust = true
+			break
+		}
+	}
+	if !rust {
+		return nil
+	}
+	toml, err := h.getRepoFile(q, tag, "Cargo.toml")
+	if err != nil {
+		log.Printf("cargo-binstall metadata failed: %s", err)
+		return nil
+	}
+	return binstallHints(q, tag, toml, ghas)
+}
+
+// goreleaserArtifact is an entry of goreleaser's dist/artifacts.json
+type goreleaserArtifact struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Goos    string `json:"goos"`
+	Goarch  string `json:"goarch"`
+	Goarm   string `json:"goarm"`
+	Goamd64 string `json:"goamd64"`
+	Extra   struct {
+		Binaries  []string `json:"Binaries"`
+		Binary    string   `json:"Binary"`
+		WrappedIn string   `json:"WrappedIn"`
+		Checksum  string   `json:"Checksum"`
+	} `json:"extra"`
+}
+
+// goreleaserHints maps the uploaded archives and binaries to their platform
+func goreleaserHints(q Query, artifacts []goreleaserArtifact, ghas ghAssets) assetHints {
+	names := map[string]bool{}
+	for _, ga := range ghas {
+		names[ga.Name] = true
+	}
+	hints := assetHints{}
+	for _, a := range artifacts {
+		if !names[a.Name] || (a.Type != "Archive" && a.Type != "Binary") {
+			continue
+		}
+		// universal darwin binaries (goarch "all") are left to the asset name
+		if a.Goos == "" || a.Goarch == "" || a.Goarch == "all" {
+			continue
+		}
+		hint := assetHint{OS: a.Goos, Arch: a.Goarch, From: "goreleaser"}
+		switch {
+		case a.Goarch == "arm" && a.Goarm != "":
+			hint.Variant = "v" + a.Goarm
+		case a.Goarch == "amd64" && a.Goamd64 != "" && a.Goamd64 != "v1":
+			hint.Variant = a.Goamd64
+		}
+		if a.Type == "Archive" {
+			bin := chooseBinary(q, a.Extra.Binaries)
+			if bin != "" && a.Extra.WrappedIn != "" {
+				bin = a.Extra.WrappedIn + "/" + bin
+			}
+			if binPathRe.MatchString(bin) {
+				hint.BinPath = bin
+			}
+		}
+		if m := goreleaserSumRe.FindStringSubmatch(a.Extra.Checksum); m != nil {
+			hint.SHA256 = m[1]
+		}
+		hints[a.Name] = hint
+	}
+	return hints
+}
+
+// chooseBinary picks the requested binary, otherwise the program, otherwise the first
+func chooseBinary(q Query, bins []string) string {
+	for _, want := range []string{q.Bin, q.Program} {
+		for _, b := range bins {
+			if want != "" && (b == want || b == want+".exe") {
+				return b
+			}
+		}
+	}
+	if len(bins) > 0 {
+		return bins[0]
+	}
+	return ""
+}
+
+// binstallHints matches the release assets against the cargo-binstall
+// pkg-url templates ([package.metadata.binstall] and its per target
+// overrides), the platform of each asset is parsed from its rust target
+func binstallHints(q Query, tag, toml string, ghas ghAssets) assetHints {
+	tables := tomlTables(toml)
+	pkg := tables["package"]
+	meta := tables["package.metadata.binstall"]
+	if pkg["name"] == "" || meta == nil {
+		return nil
+	}
+	version := pkg["version"]
+	if version == "" {
+		version = tables["workspace.package"]["version"]
+	}
+	if version == "" {
+		version = strings.TrimPrefix(tag, "v")
+	}
+	vars := map[string]string{
+		"name":    pkg["name"],
+		"version": version,
+		"repo":    fmt.Sprintf("https://github.com/%s/%s", q.User, q.Program),
+		"bin":     pkg["name"],
+	}
+	if q.Bin != "" {
+		vars["bin"] = strings.TrimSuffix(q.Bin, ".exe")
+	}
+	// templates by target, "" is the default
+	type binstall struct{ url, dir, fmt string }
+	templates := map[string]binstall{}
+	const overrides = "package.metadata.binstall.overrides."
+	for name, t := range tables {
+		if name == "package.metadata.binstall" || strings.HasPrefix(name, overrides) {
+			templates[strings.TrimPrefix(name, "package.metadata.binstall")] = binstall{t["pkg-url"], t["bin-dir"], t["pkg-fmt"]}
+		}
+	}
+	hints := assetHints{}
+	for key, override := range templates {
+		target := strings.TrimPrefix(key, ".overrides.")
+		b := templates[""]
+		if override.url != "" {
+			b.url = override.url
+		}
+		if override.dir != "" {
+			b.dir = override.dir
+		}
+		if override.fmt != "" {
+			b.fmt = override.fmt
+		}
+		if b.url == "" {
+			continue
+		}
+		re, err := binstallPattern(b.url, vars, target)
+		if err != nil {
+			log.Printf("cargo-binstall pkg-url %s: %s", b.url, err)
+			continue
+		}
+		for _, ga := range ghas {
+			m := re.FindStringSubmatch(ga.BrowserDownloadURL)
+			if m == nil {
+				continue
+			}
+			// overrides take precedence over the default template
+			if _, exists := hints[ga.Name]; exists && key == "" {
+				continue
+			}
+			assetTarget := target
+			if assetTarget == "" {
+				assetTarget = m[1]
+			}
+			hint, ok := rustTargetHint(assetTarget)
+			if !ok {
+				continue
+			}
+			if b.dir != "" && b.fmt != "bin" {
+				dir := map[string]string{"target": assetTarget, "binary-ext": ""}
+				if hint.OS == "windows" {
+					dir["binary-ext"] = ".exe"
+				}
+				for k, v := range vars {
+					dir[k] = v
+				}
+				if bin := strings.TrimPrefix(path.Clean(binstallRender(b.dir, dir)), "./"); binPathRe.MatchString(bin) {
+					hint.BinPath = bin
+				}
+			}
+			hints[ga.Name] = hint
+		}
+	}
+	return hints
+}
+
+// binstallPattern converts a pkg-url template into a regular expression,
+// capturing the target unless it is given (per target overrides)
+func binstallPattern(tmpl string, vars map[string]string, target string) (*regexp.Regexp, error) {
+	pattern := strings.Builder{}
+	pattern.WriteString("(?i)^")
+	captured := target != ""
+	if captured {
+		pattern.WriteString("()") // empty capture, the target is known
+	}
+	rest := tmpl
+	for {
+		loc := binstallVarRe.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			pattern.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		pattern.WriteString(regexp.QuoteMeta(rest[:loc[0]]))
+		name := rest[loc[2]:loc[3]]
+		switch name {
+		case "target":
+			if !captured {
+				pattern.WriteString(binstallTarget)
+				captured = true
+			} else if target != "" {
+				pattern.WriteString(regexp.QuoteMeta(target))
+			} else {
+				pattern.WriteString(`[a-z0-9_\-\.]+`)
+			}
+		case "archive-format", "archive-suffix", "format":
+			pattern.WriteString(`[\w\.]*`)
+		case "binary-ext":
+			pattern.WriteString(`(?:\.exe)?`)
+		default:
+			v, ok := vars[name]
+			if !ok {
+				pattern.WriteString(`[^/]*`)
+			} else {
+				pattern.WriteString(regexp.QuoteMeta(v))
+			}
+		}
+		rest = rest[loc[1]:]
+	}
+	if !captured {
+		return nil, fmt.Errorf("no { target } in template")
+	}
+	pattern.WriteString("$")
+	return regexp.Compile(pattern.String())
+}
+
+// binstallRender fills in the template variables
+func binstallRender(tmpl string, vars map[string]string) string {
+	return binstallVarRe.ReplaceAllStringFunc(tmpl, func(v string) string {
+		return vars[binstallVarRe.FindStringSubmatch(v)[1]]
+	})
+}
+
+// rustTargetHint is the platform of a rust target triple
+// (e.g. armv7-unknown-linux-musleabihf is linux/arm/v7/musl)
+func rustTargetHint(target string) (assetHint, bool) {
+	hint := assetHint{OS: getOS(target), Arch: getArch(target), From: "binstall"}
+	if hint.OS == "" || hint.Arch == "" {
+		return assetHint{}, false
+	}
+	hint.Variant = getVariant(target, hint.Arch)
+	if hint.OS == "linux" {
+		hint.Libc = getLibc(target)
+	}
+	return hint, true
+}
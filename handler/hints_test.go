@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBinstallHints(t *testing.T) {
+	const toml = `
+[package]
+name = "rs-tool"
+version = "1.2.0"
+
+[package.metadata.binstall]
+pkg-url = "{ repo }/releases/download/v{ version }/{ name }-{ target }.{ archive-format }"
+bin-dir = "{ name }-{ target }/{ bin }{ binary-ext }"
+pkg-fmt = "tgz"
+
+[package.metadata.binstall.overrides.x86_64-pc-windows-msvc]
+pkg-url = "{ repo }/releases/download/v{ version }/{ name }-win64.zip" # renamed
+pkg-fmt = "zip"
+`
+	url := "https://github.com/acme/rstool/releases/download/v1.2.0/"
+	ghas := ghAssets{
+		{Name: "rs-tool-x86_64-unknown-linux-musl.tgz", BrowserDownloadURL: url + "rs-tool-x86_64-unknown-linux-musl.tgz"},
+		{Name: "rs-tool-armv7-unknown-linux-gnueabihf.tgz", BrowserDownloadURL: url + "rs-tool-armv7-unknown-linux-gnueabihf.tgz"},
+		{Name: "rs-tool-win64.zip", BrowserDownloadURL: url + "rs-tool-win64.zip"},
+		{Name: "rs-tool.sha256", BrowserDownloadURL: url + "rs-tool.sha256"},
+	}
+	hints := binstallHints(Query{User: "acme", Program: "rstool"}, "v1.2.0", toml, ghas)
+	for name, expected := range map[string]assetHint{
+		"rs-tool-x86_64-unknown-linux-musl.tgz":     {OS: "linux", Arch: "amd64", Libc: "musl", BinPath: "rs-tool-x86_64-unknown-linux-musl/rs-tool"},
+		"rs-tool-armv7-unknown-linux-gnueabihf.tgz": {OS: "linux", Arch: "arm", Variant: "v7", Libc: "gnu", BinPath: "rs-tool-armv7-unknown-linux-gnueabihf/rs-tool"},
+		"rs-tool-win64.zip":                         {OS: "windows", Arch: "amd64", BinPath: "rs-tool-x86_64-pc-windows-msvc/rs-tool.exe"},
+	} {
+		expected.From = "binstall"
+		if hints[name] != expected {
+			t.Fatalf("%s: expected %+v, got %+v", name, expected, hints[name])
+		}
+	}
+	if len(hints) != 3 {
+		t.Fatalf("unexpected hints: %+v", hints)
+	}
+	// crates without binstall metadata
+	if hints := binstallHints(Query{}, "v1", "[package]\nname = \"x\"\n", ghas); len(hints) != 0 {
+		t.Fatalf("expected no hints: %+v", hints)
+	}
+}
+
+func TestGoreleaserHints(t *testing.T) {
+	artifact := func(name, typ, goos, goarch string) goreleaserArtifact {
+		return goreleaserArtifact{Name: name, Type: typ, Goos: goos, Goarch: goarch}
+	}
+	archive := artifact("tool_1.0_Mac_ARM.tar.gz", "Archive", "darwin", "arm64")
+	archive.Extra.Binaries = []string{"tool-helper", "tool"}
+	archive.Extra.WrappedIn = "tool_1.0"
+	archive.Extra.Checksum = "sha256:" + strings.Repeat("ab", 32)
+	arm := artifact("tool_1.0_pi", "Binary", "linux", "arm")
+	arm.Goarm = "6"
+	ghas := ghAssets{}
+	for _, name := range []string{"tool_1.0_Mac_ARM.tar.gz", "tool_1.0_pi", "tool_1.0.deb"} {
+		ghas = append(ghas, ghAsset{Name: name, BrowserDownloadURL: "https://x/" + name, Size: 2 * 1024 * 1024})
+	}
+	hints := goreleaserHints(Query{Program: "tool"}, []goreleaserArtifact{
+		archive,
+		arm,
+		artifact("tool_1.0.deb", "Linux Package", "linux", "amd64"),
+		artifact("tool", "Binary", "linux", "amd64"), // not uploaded
+	}, ghas)
+	if len(hints) != 2 {
+		t.Fatalf("unexpected hints: %+v", hints)
+	}
+	if h := hints["tool_1.0_Mac_ARM.tar.gz"]; h.OS != "darwin" || h.Arch != "arm64" || h.BinPath != "tool_1.0/tool" || len(h.SHA256) != 64 {
+		t.Fatalf("unexpected archive hint: %+v", h)
+	}
+	if h := hints["tool_1.0_pi"]; h.Arch != "arm" || h.Variant != "v6" || h.BinPath != "" {
+		t.Fatalf("unexpected binary hint: %+v", h)
+	}
+	// hints replace the platforms guessed from asset names
+	assets, scores := DefaultWeights.match(Query{Program: "tool"}, ghas, nil, hints)
+	if len(assets) != 2 || assets[0].Key() != "darwin/arm64" || assets[0].BinPath != "tool_1.0/tool" || assets[1].Platform() != "linux_arm_v6" {
+		t.Fatalf("unexpected assets: %+v", assets)
+	}
+	if scores[0].Rules["hint"] != DefaultWeights["hint"] {
+		t.Fatalf("expected hint rule: %+v", scores[0])
+	}
+	// the libc of goreleaser assets is detected from the asset name
+	ghas = ghAssets{}
+	for _, name := range []string{"tool_linux_gnu.tar.gz", "tool_linux_musl.tar.gz"} {
+		ghas = append(ghas, ghAsset{Name: name, BrowserDownloadURL: "https://x/" + name, Size: 2 * 1024 * 1024})
+	}
+	hints = goreleaserHints(Query{Program: "tool"}, []goreleaserArtifact{
+		artifact("tool_linux_gnu.tar.gz", "Archive", "linux", "amd64"),
+		artifact("tool_linux_musl.tar.gz", "Archive", "linux", "amd64"),
+	}, ghas)
+	assets, _ = DefaultWeights.match(Query{Program: "tool"}, ghas, nil, hints)
+	if len(assets) != 2 || assets[0].Libc == assets[1].Libc {
+		t.Fatalf("expected gnu and musl assets: %+v", assets)
+	}
+}
+
+func TestFormatsBinPath(t *testing.T) {
+	h := &Handler{cache: map[string]QueryResult{}}
+	q := Query{User: "acme", Program: "tool", Release: "latest"}
+	h.cache[q.cacheKey()] = QueryResult{
+		Query:           q,
+		ResolvedRelease: "v1.0.0",
+		Timestamp:       time.Now(),
+		Assets: Assets{{
+			Name:    "tool_1.0_linux_amd64.tar.gz",
+			OS:      "linux",
+			Arch:    "amd64",
+			URL:     "https://github.com/acme/tool/releases/download/v1.0.0/tool_1.0_linux_amd64.tar.gz",
+			Type:    ".tar.gz",
+			SHA256:  strings.Repeat("a", 64),
+			BinPath: "tool_1.0/bin/tool",
+		}},
+	}
+	for qtype, want := range map[string]string{
+		"homebrew":   `["tool_1.0/bin/tool"].find`,
+		"nix":        `binPath = "tool_1.0/bin/tool";`,
+		"dockerfile": `BINPATH="tool_1.0/bin/tool"`,
+		"action":     `BINPATH="tool_1.0/bin/tool"`,
+		"cloud-init": `BINPATH="tool_1.0/bin/tool"`,
+		"ansible":    `binpath: "tool_1.0/bin/tool"`,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/acme/tool?type="+qtype, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s failed: %s", qtype, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected %s to contain %q:\n%s", qtype, want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maximum asset (and archived executable) size downloaded for inspection
+const maxInspectSize = 128 << 20
+
+var errNotInspectable = errors.New("file type can't be inspected")
+
+// elfOS is the os of ELF executables without a specific OS ABI (System V or
+// GNU), these may be linux, android, illumos, solaris etc executables
+const elfOS = "elf"
+
+// executable found inside a release asset
+type executable struct {
+	Path   string   // path inside the archive, empty for single file assets
+	OS     string   // darwin, linux, windows etc
+	Arches []string // more than one for universal binaries
+	Size   int64
+}
+
+// runsOn reports whether the executable matches the os of an asset,
+// plain ELF executables only mismatch darwin and windows assets
+func (e executable) runsOn(os string) bool {
+	if e.OS == elfOS {
+		return os != "darwin" && os != "windows"
+	}
+	return e.OS == os
+}
+
+// inspectAssets downloads each asset and parses the headers of its
+// executables, to confirm the os and arch detected from the asset name.
+// mislabelled assets are relabelled, unless their actual platform is
+// already provided, and assets without an executable are rejected.
+func (h *Handler) inspectAssets(q Query, assets Assets) Assets {
+	provided := map[string]bool{}
+	for _, a := range assets {
+		provided[a.Key()] = true
+	}
+	inspected := make(Assets, len(assets))
+	copy(inspected, assets)
+	rejected := make([]bool, len(assets))
+	h.eachAsset(len(inspected), func(ctx context.Context, i int) {
+		a := &inspected[i]
+		exes, err := h.assetExecutables(ctx, a.URL, a.Type)
+		if err != nil {
+			// unable to inspect, trust the asset name
+			log.Printf("inspect %s: %s", a.Name, err)
+			return
+		}
+		exe, ok := chooseExecutable(exes, q.Bin)
+		if !ok {
+			log.Printf("inspect %s: rejected, no executable found", a.Name)
+			rejected[i] = true
+			return
+		}
+		// the path is embedded in install scripts
+		if !binPathRe.MatchString(exe.Path) {
+			exe.Path = ""
+		}
+		if exe.runsOn(a.OS) && slices.Contains(exe.Arches, a.Arch) {
+			a.BinPath = exe.Path
+			return
+		}
+		// plain ELF executables are most likely linux
+		actualOS := exe.OS
+		if actualOS == elfOS {
+			actualOS = "linux"
+		}
+		actual := actualOS + "/" + exe.Arches[0]
+		if provided[actual] {
+			log.Printf("inspect %s: rejected, executable is %s (not %s)", a.Name, actual, a.Key())
+			rejected[i] = true
+			return
+		}
+		log.Printf("inspect %s: relabelled %s as %s", a.Name, a.Key(), actual)
+		a.OS = actualOS
+		a.Arch = exe.Arches[0]
+		a.Variant = getVariant(a.Name, a.Arch)
+		if a.OS != "linux" {
+			a.Libc = ""
+		}
+		a.BinPath = exe.Path
+		// alternatives were labelled the same way
+		a.Alternatives = nil
+	})
+	valid := Assets{}
+	relabelled := map[string]bool{}
+	for i, a := range inspected {
+		if rejected[i] {
+			continue
+		}
+		if a.Key() != assets[i].Key() {
+			// several assets relabelled as the same platform
+			if relabelled[a.Platform()] {
+				log.Printf("inspect %s: rejected, another asset was relabelled as %s", a.Name, a.Key())
+				continue
+			}
+			relabelled[a.Platform()] = true
+		}
+		valid = append(valid, a)
+	}
+	// the order used by match, relabelled assets may have moved
+	sort.SliceStable(valid, func(i, j int) bool {
+		if valid[i].Key() != valid[j].Key() {
+			return valid[i].Key() < valid[j].Key()
+		}
+		return valid[i].Variant < valid[j].Variant
+	})
+	return valid
+}
+
+// chooseExecutable picks the executable the install script would,
+// the named binary, otherwise the largest file
+func chooseExecutable(exes []executable, bin string) (executable, bool) {
+	if len(exes) == 0 {
+		return executable{}, false
+	}
+	if bin != "" {
+		for _, e := range exes {
+			if path.Base(e.Path) == bin {
+				return e, true
+			}
+		}
+	}
+	largest := exes[0]
+	for _, e := range exes[1:] {
+		if e.Size > largest.Size {
+			largest = e
+		}
+	}
+	return largest, true
+}
+
+// inspection is the cached result of inspecting an asset
+type inspection struct {
+	exes []executable
+	err  error
+}
+
+// assetExecutables downloads the asset at url and lists its
+// executables. release assets are immutable, so results are
+// cached for the lifetime of the server (checksums included).
+// failed downloads are retried, once downloaded, the result
+// (or error) of an asset won't change.
+func (h *Handler) assetExecutables(ctx context.Context, url, ftype string) ([]executable, error) {
+	h.inspectMut.Lock()
+	cached, ok := h.inspections[url]
+	h.inspectMut.Unlock()
+	if ok {
+		return cached.exes, cached.err
+	}
+	if !inspectable(ftype) {
+		return nil, errNotInspectable
+	}
+	body, err := h.download(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	// download to disk, archives are read from the file
+	f, err := os.CreateTemp("", "installer-inspect-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(body, maxInspectSize+1))
+	if err != nil {
+		return nil, err
+	}
+	var exes []executable
+	if size > maxInspectSize {
+		err = fmt.Errorf("asset is larger than %dMB", maxInspectSize>>20)
+	} else {
+		exes, err = executables(ftype, io.NewSectionReader(f, 0, size))
+		h.sumsMut.Lock()
+		if h.sums == nil {
+			h.sums = map[string]string{}
+		}
+		h.sums[url] = hex.EncodeToString(hash.Sum(nil))
+		h.sumsMut.Unlock()
+	}
+	h.inspectMut.Lock()
+	if h.inspections == nil {
+		h.inspections = map[string]inspection{}
+	}
+	h.inspections[url] = inspection{exes: exes, err: err}
+	h.inspectMut.Unlock()
+	return exes, err
+}
+
+func inspectable(ftype string) bool {
+	switch ftype {
+	case ".tar.gz", ".tgz", ".tar.bz", ".tar.bz2", ".zip", ".gz", ".bz2", ".bin", ".exe", ".AppImage":
+		return true
+	}
+	return false
+}
+
+// executables lists the executables of an asset
+func executables(ftype string, asset *io.SectionReader) ([]executable, error) {
+	switch ftype {
+	case ".tar.gz", ".tgz":
+		zr, err := gzip.NewReader(asset)
+		if err != nil {
+			return nil, err
+		}
+		return tarExecutables(zr)
+	case ".tar.bz", ".tar.bz2":
+		return tarExecutables(bzip2.NewReader(asset))
+	case ".zip":
+		zr, err := zip.NewReader(asset, asset.Size())
+		if err != nil {
+			return nil, err
+		}
+		exes := []executable{}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			e, ok, err := readExecutable(f.Name, r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				exes = append(exes, e)
+			}
+		}
+		return exes, nil
+	case ".gz":
+		zr, err := gzip.NewReader(asset)
+		if err != nil {
+			return nil, err
+		}
+		return singleExecutable(zr)
+	case ".bz2":
+		return singleExecutable(bzip2.NewReader(asset))
+	case ".bin", ".exe", ".AppImage":
+		// already on disk, parsed in place
+		e, ok := parseExecutable(asset)
+		if !ok {
+			return nil, nil
+		}
+		e.Size = asset.Size()
+		return []executable{e}, nil
+	}
+	return nil, errNotInspectable
+}
+
+func tarExecutables(r io.Reader) ([]executable, error) {
+	tr := tar.NewReader(r)
+	exes := []executable{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return exes, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		e, ok, err := readExecutable(hdr.Name, tr)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			exes = append(exes, e)
+		}
+	}
+}
+
+func singleExecutable(r io.Reader) ([]executable, error) {
+	e, ok, err := readExecutable("", r)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return []executable{e}, nil
+}
+
+// executable magic numbers: elf, mach-o (32/64 bit, both byte
+// orders), mach-o universal and pe (dos header)
+var executableMagics = [][]byte{
+	{0x7f, 'E', 'L', 'F'},
+	{0xfe, 0xed, 0xfa, 0xce}, {0xce, 0xfa, 0xed, 0xfe},
+	{0xfe, 0xed, 0xfa, 0xcf}, {0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+	{'M', 'Z'},
+}
+
+// readExecutable parses the executable headers of the file name, only
+// files starting with an executable magic number are read (into a
+// temporary file, the headers are parsed without loading the file)
+func readExecutable(name string, r io.Reader) (executable, bool, error) {
+	head := make([]byte, 4)
+	n, err := io.ReadFull(r, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return executable{}, false, nil
+	} else if err != nil {
+		return executable{}, false, err
+	}
+	if !slices.ContainsFunc(executableMagics, func(m []byte) bool { return bytes.HasPrefix(head[:n], m) }) {
+		return executable{}, false, nil
+	}
+	f, err := os.CreateTemp("", "installer-inspect-*")
+	if err != nil {
+		return executable{}, false, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, io.LimitReader(io.MultiReader(bytes.NewReader(head), r), maxInspectSize+1))
+	if err != nil {
+		return executable{}, false, err
+	}
+	if size > maxInspectSize {
+		return executable{}, false, fmt.Errorf("%s is larger than %dMB", name, maxInspectSize>>20)
+	}
+	e, ok := parseExecutable(io.NewSectionReader(f, 0, size))
+	e.Path = strings.TrimPrefix(path.Clean("/"+name), "/")
+	e.Size = size
+	return e, ok, nil
+}
+
+// parseExecutable detects the os and arch of an executable
+func parseExecutable(r io.ReaderAt) (executable, bool) {
+	if f, err := elf.NewFile(r); err == nil {
+		arch := elfArch(f)
+		goos := elfOS
+		switch f.OSABI {
+		case elf.ELFOSABI_FREEBSD:
+			goos = "freebsd"
+		case elf.ELFOSABI_NETBSD:
+			goos = "netbsd"
+		case elf.ELFOSABI_OPENBSD:
+			goos = "openbsd"
+		}
+		return executable{OS: goos, Arches: []string{arch}}, arch != "" && elfExecutable(f)
+	}
+	if f, err := macho.NewFile(r); err == nil {
+		arch := machoArchs[f.Cpu]
+		return executable{OS: "darwin", Arches: []string{arch}}, arch != "" && f.Type == macho.TypeExec
+	}
+	if f, err := macho.NewFatFile(r); err == nil {
+		e := executable{OS: "darwin"}
+		for _, fa := range f.Arches {
+			if arch := machoArchs[fa.Cpu]; arch != "" && fa.Type == macho.TypeExec {
+				e.Arches = append(e.Arches, arch)
+			}
+		}
+		return e, len(e.Arches) > 0
+	}
+	if f, err := pe.NewFile(r); err == nil {
+		arch := peArchs[f.Machine]
+		// dlls are not installable
+		return executable{OS: "windows", Arches: []string{arch}}, arch != "" && f.Characteristics&pe.IMAGE_FILE_DLL == 0
+	}
+	return executable{}, false
+}
+
+// elfExecutable reports whether f is an executable, position independent
+// executables are distinguished from shared libraries by their interpreter
+// (dynamically linked) or the pie flag (statically linked)
+func elfExecutable(f *elf.File) bool {
+	switch f.Type {
+	case elf.ET_EXEC:
+		return true
+	case elf.ET_DYN:
+		for _, p := range f.Progs {
+			if p.Type == elf.PT_INTERP {
+				return true
+			}
+		}
+		flags, _ := f.DynValue(elf.DT_FLAGS_1)
+		return len(flags) > 0 && flags[0]&uint64(elf.DF_1_PIE) != 0
+	}
+	return false
+}
+
+func elfArch(f *elf.File) string {
+	le := f.ByteOrder == binary.LittleEndian
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_RISCV:
+		if f.Class == elf.ELFCLASS64 {
+			return "riscv64"
+		}
+	case elf.EM_PPC64:
+		if le {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_LOONGARCH:
+		return "loong64"
+	case elf.EM_MIPS:
+		arch := "mips"
+		if f.Class == elf.ELFCLASS64 {
+			arch += "64"
+		}
+		if le {
+			arch += "le"
+		}
+		return arch
+	}
+	return ""
+}
+
+var machoArchs = map[macho.Cpu]string{
+	macho.Cpu386:   "386",
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc64: "ppc64",
+}
+
+var peArchs = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+}
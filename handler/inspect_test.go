@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+// inspected archives contain the test binary, an executable of this platform
+func TestInspectAssets(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targz := func(files map[string][]byte) []byte {
+		b := bytes.Buffer{}
+		zw := gzip.NewWriter(&b)
+		tw := tar.NewWriter(zw)
+		for name, data := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg})
+			tw.Write(data)
+		}
+		tw.Close()
+		zw.Close()
+		return b.Bytes()
+	}
+	zipped := func(files map[string][]byte) []byte {
+		b := bytes.Buffer{}
+		zw := zip.NewWriter(&b)
+		for name, data := range files {
+			w, _ := zw.Create(name)
+			w.Write(data)
+		}
+		zw.Close()
+		return b.Bytes()
+	}
+	readme := []byte("# tool\n")
+	files := map[string][]byte{
+		"/tool.tar.gz":   targz(map[string][]byte{"./tool-1.0/README.md": readme, "./tool-1.0/tool": bin}),
+		"/tool.zip":      zipped(map[string][]byte{"tool.exe": bin, "README.md": readme}),
+		"/docs.tar.gz":   targz(map[string][]byte{"README.md": readme}),
+		"/tool.tar.zst":  []byte("not inspectable"),
+		"/broken.tar.gz": []byte("not gzipped"),
+	}
+	downloads := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		if b, ok := files[r.URL.Path]; ok {
+			w.Write(b)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	h := &Handler{Client: srv.Client()}
+	asset := func(name, os, arch, path string) Asset {
+		return Asset{Name: name, OS: os, Arch: arch, URL: srv.URL + path, Type: getFileExt(path)}
+	}
+	other := "plan9"
+	assets := h.inspectAssets(Query{}, Assets{
+		asset("tool_native.tar.gz", runtime.GOOS, runtime.GOARCH, "/tool.tar.gz"),
+		asset("tool_other.zip", other, "386", "/tool.zip"),
+		asset("tool_docs.tar.gz", other, "amd64", "/docs.tar.gz"),
+		asset("tool_other.tar.zst", other, "arm64", "/tool.tar.zst"),
+		asset("tool_broken.tar.gz", other, "riscv64", "/broken.tar.gz"),
+	})
+	// mislabelled (platform already provided) and executable-less assets are rejected,
+	// assets which can't be inspected are trusted
+	found := map[string]Asset{}
+	for _, a := range assets {
+		found[a.Name] = a
+	}
+	if len(found) != 3 || found["tool_other.tar.zst"].Name == "" || found["tool_broken.tar.gz"].Name == "" {
+		t.Fatalf("unexpected assets: %+v", assets)
+	}
+	if a := found["tool_native.tar.gz"]; a.BinPath != "tool-1.0/tool" {
+		t.Fatalf("expected the binary path to be recorded: %+v", a)
+	}
+	if h.sums[srv.URL+"/tool.tar.gz"] == "" {
+		t.Fatalf("expected the checksum to be cached")
+	}
+	// mislabelled assets are relabelled when their platform is missing
+	assets = h.inspectAssets(Query{}, Assets{asset("tool_other.zip", other, "386", "/tool.zip")})
+	if len(assets) != 1 || assets[0].Key() != runtime.GOOS+"/"+runtime.GOARCH || assets[0].BinPath != "tool.exe" {
+		t.Fatalf("expected asset to be relabelled: %+v", assets)
+	}
+	// plain ELF executables also run on other ELF platforms (e.g. android)
+	if runtime.GOOS == "linux" {
+		assets = h.inspectAssets(Query{}, Assets{
+			asset("tool_linux.tar.gz", "linux", runtime.GOARCH, "/tool.tar.gz"),
+			asset("tool_android.tar.gz", "android", runtime.GOARCH, "/tool.tar.gz"),
+		})
+		if len(assets) != 2 || assets[0].OS != "android" {
+			t.Fatalf("expected the android asset to be kept: %+v", assets)
+		}
+	}
+	// inspections are cached, including failures
+	h.inspectAssets(Query{}, Assets{asset("tool_broken.tar.gz", other, "riscv64", "/broken.tar.gz")})
+	if n := downloads.Load(); n != 4 {
+		t.Fatalf("expected 4 downloads, got %d", n)
+	}
+}
+
+func TestChooseExecutable(t *testing.T) {
+	exes := []executable{
+		{Path: "bin/tool", Size: 10},
+		{Path: "bin/tool-helper", Size: 20},
+	}
+	if e, _ := chooseExecutable(exes, ""); e.Path != "bin/tool-helper" {
+		t.Fatalf("expected the largest executable, got %s", e.Path)
+	}
+	if e, _ := chooseExecutable(exes, "tool"); e.Path != "bin/tool" {
+		t.Fatalf("expected the named executable, got %s", e.Path)
+	}
+	if _, ok := chooseExecutable(nil, ""); ok {
+		t.Fatalf("expected no executable")
+	}
+	for path, valid := range map[string]bool{
+		"tool":           true,
+		"tool-1.0/tool":  true,
+		"../tool":        false,
+		"tool/$(reboot)": false,
+		"/tool":          false,
+	} {
+		if binPathRe.MatchString(path) != valid {
+			t.Fatalf("expected binPathRe to match %s: %v", path, valid)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/jpillora/installer/scripts"
+)
+
+const (
+	lockVersion  = 1
+	maxLockTools = 32
+	maxLockBody  = 1 << 20
+	// stored locks (?lock=<hash>) expire, and are limited in number
+	lockTTL  = 24 * time.Hour
+	maxLocks = 1000
+)
+
+type lockEntry struct {
+	lock      Lock
+	timestamp time.Time
+}
+
+// Lock pins each tool to an exact release tag,
+// and each of its assets to a SHA-256 checksum
+type Lock struct {
+	Version int
+	Tools   []LockTool
+}
+
+// LockTool is a locked user/repo@constraint query
+type LockTool struct {
+	Query   string // as requested, e.g. jpillora/serve@v1.9
+	User    string
+	Program string
+	Tag     string
+	Bin     string `json:",omitempty"` // binary name inside the assets, see Query.Bin
+	Assets  Assets
+}
+
+// HasM1 reports whether the tool has a native apple silicon asset
+func (t LockTool) HasM1() bool {
+	return t.Assets.HasM1()
+}
+
+// newLockTool pins a query result, which must have
+// a checksum for every asset (see withSHA256)
+func newLockTool(query string, result QueryResult) (LockTool, error) {
+	for _, a := range result.Assets {
+		if a.SHA256 == "" {
+			return LockTool{}, fmt.Errorf("no sha256 for %s/%s asset %s", result.User, result.Program, a.Name)
+		}
+	}
+	return LockTool{
+		Query:   query,
+		User:    result.User,
+		Program: result.Program,
+		Tag:     result.ResolvedRelease,
+		Bin:     result.Bin,
+		Assets:  result.Assets,
+	}, nil
+}
+
+// validate ensures an uploaded lock is safe to embed in an install script
+func (l Lock) validate() error {
+	if l.Version != lockVersion {
+		return fmt.Errorf("unsupported lock version %d", l.Version)
+	}
+	if len(l.Tools) == 0 {
+		return errors.New("lock has no tools")
+	}
+	if len(l.Tools) > maxLockTools {
+		return fmt.Errorf("lock has too many tools (max %d)", maxLockTools)
+	}
+	for _, t := range l.Tools {
+		if !lockNameRe.MatchString(t.User) || !lockNameRe.MatchString(t.Program) {
+			return fmt.Errorf("invalid lock tool %s/%s", t.User, t.Program)
+		}
+		if !lockTagRe.MatchString(t.Tag) {
+			return fmt.Errorf("invalid lock tag %s", t.Tag)
+		}
+		if !lockQueryRe.MatchString(t.Query) {
+			return fmt.Errorf("invalid lock query %s", t.Query)
+		}
+		if t.Bin != "" && !binNameRe.MatchString(t.Bin) {
+			return fmt.Errorf("invalid lock binary name %s", t.Bin)
+		}
+		if len(t.Assets) == 0 {
+			return fmt.Errorf("no assets locked for %s/%s", t.User, t.Program)
+		}
+		for _, a := range t.Assets {
+			switch {
+			case !lockNameRe.MatchString(a.OS) || !lockNameRe.MatchString(a.Arch):
+				return fmt.Errorf("invalid lock platform %s", a.Key())
+			case !lockNameRe.MatchString(a.Name):
+				return fmt.Errorf("invalid lock asset name %s", a.Name)
+			case !lockURLRe.MatchString(a.URL):
+				return fmt.Errorf("invalid lock asset url %s", a.URL)
+			case !lockTypeRe.MatchString(a.Type):
+				return fmt.Errorf("invalid lock asset type %s", a.Type)
+			case !sha256Re.MatchString(a.SHA256):
+				return fmt.Errorf("invalid lock asset sha256 %s", a.SHA256)
+			case a.Variant != "" && !lockVariantRe.MatchString(a.Variant):
+				return fmt.Errorf("invalid lock asset variant %s", a.Variant)
+			case a.Libc != "" && !lockLibcRe.MatchString(a.Libc):
+				return fmt.Errorf("invalid lock asset libc %s", a.Libc)
+			case a.BinPath != "" && !binPathRe.MatchString(a.BinPath):
+				return fmt.Errorf("invalid lock asset binary path %s", a.BinPath)
+			case len(a.Alternatives) > 0:
+				// locks pin a single asset per platform (see Assets.Primary)
+				return fmt.Errorf("invalid lock asset %s, alternatives are not locked", a.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// parseLockQueries splits a whitespace or comma separated
+// list of user/repo@constraint queries
+func (h *Handler) parseLockQueries(s string) ([]Query, []string, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(fields) == 0 {
+		return nil, nil, errors.New("no queries provided")
+	}
+	if len(fields) > maxLockTools {
+		return nil, nil, fmt.Errorf("too many queries (max %d)", maxLockTools)
+	}
+	qs := []Query{}
+	for _, f := range fields {
+		user, rest := splitHalf(f, "/")
+		program, release := splitHalf(rest, "@")
+		if !lockQueryRe.MatchString(f) {
+			return nil, nil, fmt.Errorf("invalid query %s, expected user/repo@constraint", f)
+		}
+		if release == "" {
+			release = "latest"
+		}
+		q := Query{User: user, Program: program, Release: release, Constraint: true}
+		if h.Config.ForceUser != "" {
+			q.User = h.Config.ForceUser
+		}
+		if h.Config.ForceRepo != "" {
+			q.Program = h.Config.ForceRepo
+		}
+		qs = append(qs, q)
+	}
+	return qs, fields, nil
+}
+
+// encodeLock returns the lockfile and its SHA-256,
+// which is used to address the lock
+func encodeLock(l Lock) (string, []byte) {
+	b, _ := json.MarshalIndent(l, "", "  ")
+	b = append(b, '\n')
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), b
+}
+
+// storeLock keeps the lock in memory for ?lock=<hash>, evicting
+// expired locks, then the oldest lock when there are too many
+func (h *Handler) storeLock(l Lock) (string, []byte) {
+	hash, b := encodeLock(l)
+	h.locksMut.Lock()
+	defer h.locksMut.Unlock()
+	if h.locks == nil {
+		h.locks = map[string]lockEntry{}
+	}
+	oldest := ""
+	for k, e := range h.locks {
+		if time.Since(e.timestamp) > lockTTL {
+			delete(h.locks, k)
+		} else if oldest == "" || e.timestamp.Before(h.locks[oldest].timestamp) {
+			oldest = k
+		}
+	}
+	if _, exists := h.locks[hash]; !exists && len(h.locks) >= maxLocks {
+		delete(h.locks, oldest)
+	}
+	h.locks[hash] = lockEntry{lock: l, timestamp: time.Now()}
+	return hash, b
+}
+
+// storedLock returns the lock stored with storeLock
+func (h *Handler) storedLock(hash string) (Lock, bool) {
+	h.locksMut.Lock()
+	defer h.locksMut.Unlock()
+	e, ok := h.locks[hash]
+	if !ok || time.Since(e.timestamp) > lockTTL {
+		return Lock{}, false
+	}
+	return e.lock, true
+}
+
+// writeLock responds with the lockfile
+func (h *Handler) writeLock(w http.ResponseWriter, l Lock) {
+	hash, b := h.storeLock(l)
+	log.Printf("serving lock %s (%d tools)", hash, len(l.Tools))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Lock-Hash", hash)
+	w.Write(b)
+}
+
+// serveLock resolves the posted queries into a lockfile
+func (h *Handler) serveLock(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLockBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	qs, requested, err := h.parseLockQueries(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	l := Lock{Version: lockVersion}
+	for i, q := range qs {
+		result, err := h.execute(q)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %s", requested[i], err), http.StatusBadGateway)
+			return
+		}
+		result.Assets = h.withSHA256(result.Assets.Extractable().Primary())
+		t, err := newLockTool(requested[i], result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		l.Tools = append(l.Tools, t)
+	}
+	h.writeLock(w, l)
+}
+
+// serveLockInstall renders an install script for a stored
+// lock (?lock=<hash>) or an uploaded lockfile (POST body)
+func (h *Handler) serveLockInstall(w http.ResponseWriter, r *http.Request) {
+	showError := func(msg string, code int) {
+		// prevent shell injection
+		cleaned := errMsgRe.ReplaceAllString(msg, "")
+		http.Error(w, fmt.Sprintf("echo '%s'", cleaned), code)
+	}
+	w.Header().Set("Content-Type", "text/x-shellscript")
+	l := Lock{}
+	if hash := r.URL.Query().Get("lock"); hash != "" {
+		stored, ok := h.storedLock(hash)
+		if !ok {
+			showError("Lock not found: "+hash, http.StatusNotFound)
+			return
+		}
+		l = stored
+	} else {
+		body := http.MaxBytesReader(w, r.Body, maxLockBody)
+		if err := json.NewDecoder(body).Decode(&l); err != nil {
+			showError("Invalid lockfile: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := l.validate(); err != nil {
+		showError(err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir, err := installDir(r.URL.Query())
+	if err != nil {
+		showError(err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, v := range []string{r.URL.Query().Get("os"), r.URL.Query().Get("arch")} {
+		if v != "" && !lockNameRe.MatchString(v) {
+			showError("Invalid platform", http.StatusBadRequest)
+			return
+		}
+	}
+	hash, _ := encodeLock(l)
+	data := struct {
+		Query
+		Lock
+		Hash    string
+		M1Asset bool
+	}{
+		Query: Query{
+			Insecure:   r.URL.Query().Get("insecure") == "1",
+			OS:         r.URL.Query().Get("os"),
+			Arch:       r.URL.Query().Get("arch"),
+			Force:      r.URL.Query().Get("force") == "1",
+			MoveToPath: r.URL.Query().Get("move") == "1",
+			Dir:        dir,
+
+			Unquarantine: r.URL.Query().Get("unquarantine") == "1",
+		},
+		Lock: l,
+		Hash: hash,
+		// rosetta fallback is decided per tool
+		M1Asset: true,
+	}
+	t, err := template.New("installer").Parse(string(scripts.Lock))
+	if err == nil {
+		_, err = t.Parse(string(scripts.Common))
+	}
+	if err != nil {
+		showError("installer BUG: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buff := bytes.Buffer{}
+	if err := t.Execute(&buff, data); err != nil {
+		showError("Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("serving lock script %s (%d tools)", hash, len(l.Tools))
+	w.Write(buff.Bytes())
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func testLockHandler(assets Assets) *Handler {
+	q := Query{User: "acme", Program: "foo", Release: "v1", Constraint: true}
+	return &Handler{
+		cache: map[string]QueryResult{
+			q.cacheKey(): {
+				Query:           q,
+				ResolvedRelease: "v1.2.3",
+				Timestamp:       time.Now(),
+				Assets:          assets,
+			},
+		},
+	}
+}
+
+func TestLock(t *testing.T) {
+	h := testLockHandler(Assets{{
+		Name:    "foo_linux_amd64.tar.gz",
+		OS:      "linux",
+		Arch:    "amd64",
+		URL:     "https://github.com/acme/foo/releases/download/v1.2.3/foo_linux_amd64.tar.gz",
+		Type:    ".tar.gz",
+		SHA256:  testSum,
+		BinPath: "foo_1.2.3/foo",
+	}})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/lock", strings.NewReader("acme/foo@v1\n")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("lock failed: %s", w.Body.String())
+	}
+	hash := w.Header().Get("X-Lock-Hash")
+	sum := sha256.Sum256(w.Body.Bytes())
+	if hash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expected lock hash %s to be the sha256 of the lockfile", hash)
+	}
+	l := Lock{}
+	if err := json.Unmarshal(w.Body.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Tools) != 1 || l.Tools[0].Tag != "v1.2.3" || l.Tools[0].Query != "acme/foo@v1" {
+		t.Fatalf("unexpected lock tools: %+v", l.Tools)
+	}
+	// install from the stored lock
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/install?lock="+hash, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("lock install failed: %s", w.Body.String())
+	}
+	for _, want := range []string{`TAG="v1.2.3"`, `SHA256="` + testSum + `"`, `BINPATH="foo_1.2.3/foo"`, "checksum mismatch", `FORCE=""`, `[ "$FORCE" != "true" ] && is_installed`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected lock script to contain %q", want)
+		}
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/install?lock="+hash+"&force=1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `FORCE="true"`) {
+		t.Fatalf("expected a forced lock script: %s", w.Body.String())
+	}
+	// uploaded lockfile, with a binary name
+	l.Tools[0].Bin = "foo-cli"
+	b, _ := json.Marshal(l)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/install", strings.NewReader(string(b))))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `BIN="foo-cli"`) {
+		t.Fatalf("expected uploaded lock script with the binary name: %s", w.Body.String())
+	}
+	// queries are embedded in the script
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/lock", strings.NewReader("acme/foo@v1$(id)")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid query to fail, got %d", w.Code)
+	}
+	// unknown lock
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/install?lock=abc", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown lock to be not found, got %d", w.Code)
+	}
+}
+
+func TestLockMissingChecksum(t *testing.T) {
+	h := testLockHandler(Assets{{
+		Name: "foo_linux_amd64.tar.gz",
+		OS:   "linux",
+		Arch: "amd64",
+		URL:  "https://github.com/acme/foo/releases/download/v1.2.3/foo_linux_amd64.tar.gz",
+		Type: ".tar.gz",
+	}})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/lock", strings.NewReader("acme/foo@v1")))
+	if w.Code == http.StatusOK {
+		t.Fatalf("expected lock without checksums to fail")
+	}
+}
+
+func TestLockExtractable(t *testing.T) {
+	url := "https://github.com/acme/foo/releases/download/v1.2.3/"
+	h := testLockHandler(Assets{{
+		Name:   "foo.dmg",
+		OS:     "darwin",
+		Arch:   "arm64",
+		URL:    url + "foo.dmg",
+		Type:   ".dmg",
+		SHA256: testSum,
+		Alternatives: Assets{{
+			Name:   "foo_darwin_arm64.zip",
+			OS:     "darwin",
+			Arch:   "arm64",
+			URL:    url + "foo_darwin_arm64.zip",
+			Type:   ".zip",
+			SHA256: testSum,
+		}},
+	}})
+	// posted and ?type=lock locks pin the same assets
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/lock", strings.NewReader("acme/foo@v1")))
+	l := Lock{}
+	if err := json.Unmarshal(w.Body.Bytes(), &l); err != nil {
+		t.Fatalf("lock failed: %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/acme/foo@v1?type=lock", nil))
+	single := Lock{}
+	if err := json.Unmarshal(w.Body.Bytes(), &single); err != nil {
+		t.Fatalf("lock failed: %s", w.Body.String())
+	}
+	for _, l := range []Lock{l, single} {
+		if a := l.Tools[0].Assets; len(a) != 1 || a[0].Name != "foo_darwin_arm64.zip" {
+			t.Fatalf("expected the zip to be locked: %+v", a)
+		}
+	}
+}
+
+func TestLockValidate(t *testing.T) {
+	valid := func() Lock {
+		return Lock{Version: lockVersion, Tools: []LockTool{{
+			Query:   "acme/foo@v1",
+			User:    "acme",
+			Program: "foo",
+			Tag:     "v1.2.3",
+			Assets: Assets{{
+				Name:   "foo_linux_amd64.tar.gz",
+				OS:     "linux",
+				Arch:   "amd64",
+				URL:    "https://github.com/acme/foo/releases/download/v1.2.3/foo_linux_amd64.tar.gz",
+				Type:   ".tar.gz",
+				SHA256: testSum,
+			}},
+		}}}
+	}
+	if err := valid().validate(); err != nil {
+		t.Fatalf("expected valid lock, got %s", err)
+	}
+	l := valid()
+	l.Tools[0].Assets[0].Variant = "v3"
+	l.Tools[0].Assets[0].Libc = "musl"
+	l.Tools[0].Assets[0].BinPath = "foo_1.2.3/bin/foo"
+	l.Tools[0].Bin = "foo-cli"
+	if err := l.validate(); err != nil {
+		t.Fatalf("expected valid lock, got %s", err)
+	}
+	tests := map[string]func(l *Lock){
+		"version":  func(l *Lock) { l.Version = 2 },
+		"no tools": func(l *Lock) { l.Tools = nil },
+		"user":     func(l *Lock) { l.Tools[0].User = `acme"; rm -rf /; "` },
+		"tag":      func(l *Lock) { l.Tools[0].Tag = "$(id)" },
+		"bin":      func(l *Lock) { l.Tools[0].Bin = "foo/../$(id)" },
+		"query":    func(l *Lock) { l.Tools[0].Query = "x\ntouch /tmp/pwned\n#" },
+		"url":      func(l *Lock) { l.Tools[0].Assets[0].URL = "https://example.com/$(id)" },
+		"http":     func(l *Lock) { l.Tools[0].Assets[0].URL = "http://example.com/foo.tar.gz" },
+		"type":     func(l *Lock) { l.Tools[0].Assets[0].Type = "`id`.gz" },
+		"sha256":   func(l *Lock) { l.Tools[0].Assets[0].SHA256 = "" },
+		"variant":  func(l *Lock) { l.Tools[0].Assets[0].Variant = `v7"; id; "` },
+		"libc":     func(l *Lock) { l.Tools[0].Assets[0].Libc = "$(id)" },
+		"bin path": func(l *Lock) { l.Tools[0].Assets[0].BinPath = "../$(id)" },
+		"alternatives": func(l *Lock) {
+			l.Tools[0].Assets[0].Alternatives = Assets{l.Tools[0].Assets[0]}
+		},
+	}
+	for name, modify := range tests {
+		l := valid()
+		modify(&l)
+		if err := l.validate(); err == nil {
+			t.Fatalf("%s: expected invalid lock", name)
+		}
+	}
+}
+
+func TestLockStore(t *testing.T) {
+	h := &Handler{}
+	first, _ := h.storeLock(Lock{Version: 0})
+	for i := 1; i <= maxLocks; i++ {
+		h.storeLock(Lock{Version: i})
+	}
+	if len(h.locks) != maxLocks {
+		t.Fatalf("expected %d stored locks, got %d", maxLocks, len(h.locks))
+	}
+	if _, ok := h.storedLock(first); ok {
+		t.Fatalf("expected the oldest lock to be evicted")
+	}
+	// expired locks are not found
+	hash, _ := h.storeLock(Lock{Version: -1})
+	e := h.locks[hash]
+	e.timestamp = time.Now().Add(-lockTTL - time.Minute)
+	h.locks[hash] = e
+	if _, ok := h.storedLock(hash); ok {
+		t.Fatalf("expected the expired lock not to be found")
+	}
+}
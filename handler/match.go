@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Weights are the points given by each asset scoring rule
+// (see DefaultWeights), assets are selected by highest score
+type Weights map[string]int
+
+// DefaultWeights of the asset scoring rules
+var DefaultWeights = Weights{
+	"os":            4,  // os found in the asset name, otherwise assumed to be linux
+	"arch":          4,  // arch found in the asset name, otherwise assumed to be amd64
+	"hint":          4,  // platform described by release metadata (cargo-binstall or goreleaser)
+	"static":        2,  // statically linked
+	"libc.musl":     2,  // musl builds are usually static
+	"libc.gnu":      -1, // glibc builds require a compatible glibc
+	"name":          1,  // asset name starts with the program name
+	"size":          1,  // at least 1MB, smaller archives rarely contain the binary
+	"source":        -8, // source code archive
+	"type.bin":      2,  // no extraction required
+	"type.exe":      2,
+	"type.tar.gz":   2,
+	"type.tgz":      2,
+	"type.tar.xz":   2,
+	"type.txz":      2,
+	"type.tar.bz":   1,
+	"type.tar.bz2":  1,
+	"type.tar.zst":  1, // zstd is not installed everywhere
+	"type.zip":      1,
+	"type.gz":       1,
+	"type.bz2":      1,
+	"type.xz":       1,
+	"type.AppImage": 1, // requires FUSE
+	"type.zst":      0,
+	"type.tar.lz":   0,
+	"type.tar.lz4":  0,
+	"type.lz4":      0,
+	"type.7z":       0,
+	"type.dmg":      0,  // macOS disk image
+	"type.pkg":      -1, // macOS installer package, requires sudo
+}
+
+// ParseWeights returns the default weights, overridden by
+// whitespace separated <rule>=<points> entries
+func ParseWeights(entries []string) (Weights, error) {
+	w := Weights{}
+	for rule, points := range DefaultWeights {
+		w[rule] = points
+	}
+	for _, e := range entries {
+		for _, f := range strings.Fields(e) {
+			rule, value := splitHalf(f, "=")
+			if _, ok := DefaultWeights[rule]; !ok {
+				return nil, fmt.Errorf("unknown weight rule '%s'", rule)
+			}
+			points, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight %s: %w", f, err)
+			}
+			w[rule] = points
+		}
+	}
+	return w, nil
+}
+
+// weights used by the handler, defaults to DefaultWeights
+func (h *Handler) weights() Weights {
+	if h.Weights != nil {
+		return h.Weights
+	}
+	return DefaultWeights
+}
+
+// AssetScore is the score breakdown of a release asset
+type AssetScore struct {
+	Name     string
+	Platform string         `json:",omitempty"`
+	Score    int            `json:",omitempty"`
+	Rules    map[string]int `json:",omitempty"` // points given by each rule
+	Selected bool
+	Reason   string `json:",omitempty"` // why the asset was not selected
+}
+
+// scoredAsset is an asset which can be installed on its platform
+type scoredAsset struct {
+	Asset
+	score   *AssetScore
+	guessed int // number of os and arch guesses
+}
+
+// match scores the release assets, selecting the highest
+// scoring asset of each platform (os/arch/variant/libc),
+// hinted assets use the platform described by the release metadata
+func (w Weights) match(q Query, ghas ghAssets, sums map[string]string, hints assetHints) (Assets, []AssetScore) {
+	scores := make([]AssetScore, len(ghas))
+	candidates := []scoredAsset{}
+	for i, ga := range ghas {
+		s := &scores[i]
+		s.Name = ga.Name
+		url := ga.BrowserDownloadURL
+		// only binary containers are supported
+		// TODO deb,rpm etc
+		fext := getFileExt(url)
+		if fext == "" && ga.Size > 1024*1024 {
+			fext = ".bin" // +1MB binary
+		}
+		if _, ok := w["type"+fext]; !ok {
+			s.Reason = fmt.Sprintf("unsupported file type (ext '%s')", fext)
+			continue
+		}
+		// user selecting a particular asset?
+		if q.Select != "" && !strings.Contains(ga.Name, q.Select) {
+			s.Reason = "excluded by select"
+			continue
+		}
+		s.Rules = map[string]int{}
+		rule := func(name string) {
+			if points := w[name]; points != 0 {
+				s.Rules[name] = points
+				s.Score += points
+			}
+		}
+		name := strings.ToLower(ga.Name)
+		c := scoredAsset{
+			Asset: Asset{
+				OS:     getOS(ga.Name),
+				Arch:   getArch(ga.Name),
+				Name:   ga.Name,
+				URL:    url,
+				Type:   fext,
+				SHA256: sums[ga.Name],
+			},
+			score: s,
+		}
+		hint, hinted := hints[ga.Name]
+		if hinted {
+			c.OS, c.Arch = hint.OS, hint.Arch
+		}
+		// disk images and installer packages are macOS only
+		// (freebsd packages also use .pkg)
+		macOnly := fext == ".dmg" || fext == ".pkg"
+		if macOnly && c.OS != "" && c.OS != "darwin" {
+			s.Reason = fmt.Sprintf("unsupported file type for %s (ext '%s')", c.OS, fext)
+			continue
+		}
+		libc := getLibc(ga.Name)
+		// goreleaser hints don't describe the libc
+		if hinted && hint.Libc != "" {
+			libc = hint.Libc
+		}
+		switch {
+		case c.OS != "":
+			rule("os")
+		case macOnly:
+			c.OS = "darwin"
+			rule("os")
+		case fext == ".exe":
+			// windows executables, used by scoop manifests
+			c.OS = "windows"
+			rule("os")
+		case libc != "":
+			// libc implies linux (e.g. musllinux)
+			c.OS = "linux"
+			rule("os")
+		default:
+			c.OS = "linux"
+			c.guessed++
+		}
+		if c.Arch != "" {
+			rule("arch")
+		} else {
+			c.Arch = "amd64"
+			c.guessed++
+		}
+		c.Variant = getVariant(ga.Name, c.Arch)
+		if hinted {
+			rule("hint")
+			c.Variant = hint.Variant
+			c.BinPath = hint.BinPath
+			if c.SHA256 == "" {
+				c.SHA256 = hint.SHA256
+			}
+		}
+		if c.OS == "linux" {
+			c.Libc = libc
+		}
+		if c.Libc != "" {
+			rule("libc." + c.Libc)
+		}
+		if strings.Contains(name, "static") {
+			rule("static")
+		}
+		if strings.HasPrefix(name, strings.ToLower(q.Program)) {
+			rule("name")
+		}
+		if ga.Size >= 1024*1024 {
+			rule("size")
+		}
+		if strings.Contains(name, "src") || strings.Contains(name, "source") {
+			rule("source")
+		}
+		rule("type" + fext)
+		s.Platform = c.Platform()
+		candidates = append(candidates, c)
+	}
+	// highest score first, ties broken by name
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score.Score != b.score.Score {
+			return a.score.Score > b.score.Score
+		}
+		return a.Name < b.Name
+	})
+	// guesses are only used when no asset names the os/arch
+	leastGuessed := map[string]int{}
+	for _, c := range candidates {
+		if g, ok := leastGuessed[c.Key()]; !ok || c.guessed < g {
+			leastGuessed[c.Key()] = c.guessed
+		}
+	}
+	selected := []scoredAsset{}
+	best := map[string]int{}
+	for _, c := range candidates {
+		if c.guessed > leastGuessed[c.Key()] {
+			c.score.Reason = "os/arch guessed, other assets match " + c.Key()
+			continue
+		}
+		i, ok := best[c.Platform()]
+		if !ok {
+			best[c.Platform()] = len(selected)
+			c.score.Selected = true
+			selected = append(selected, c)
+			continue
+		}
+		// other file types are kept, for hosts which can't decompress the best
+		s := &selected[i]
+		if s.Type != c.Type && !s.Alternatives.hasType(c.Type) {
+			c.score.Reason = "alternative to " + s.Name
+			s.Alternatives = append(s.Alternatives, c.Asset)
+			continue
+		}
+		c.score.Reason = "lower score than " + s.Name
+	}
+	// variants of each os/arch, the most portable
+	// (lowest level, then highest score) first
+	sort.SliceStable(selected, func(i, j int) bool {
+		a, b := selected[i], selected[j]
+		if a.Key() != b.Key() {
+			return a.Key() < b.Key()
+		}
+		return a.Variant < b.Variant
+	})
+	assets := Assets{}
+	for _, c := range selected {
+		assets = append(assets, c.Asset)
+	}
+	return assets, scores
+}
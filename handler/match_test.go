@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseWeights(t *testing.T) {
+	w, err := ParseWeights([]string{"libc.gnu=3 static=0", "type.zip=-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w["libc.gnu"] != 3 || w["static"] != 0 || w["type.zip"] != -2 || w["os"] != DefaultWeights["os"] {
+		t.Fatalf("unexpected weights: %v", w)
+	}
+	if DefaultWeights["libc.gnu"] != -1 {
+		t.Fatalf("expected defaults to be unchanged")
+	}
+	for _, invalid := range []string{"nope=1", "os=high"} {
+		if _, err := ParseWeights([]string{invalid}); err == nil {
+			t.Fatalf("expected %s to be invalid", invalid)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	const mb = 2 * 1024 * 1024
+	ghas := ghAssets{
+		{Name: "tool_src.tar.gz", BrowserDownloadURL: "https://x/tool_src.tar.gz", Size: mb},
+		{Name: "tool.tar.gz", BrowserDownloadURL: "https://x/tool.tar.gz", Size: mb},
+		{Name: "tool_linux_amd64.zip", BrowserDownloadURL: "https://x/tool_linux_amd64.zip", Size: mb},
+		{Name: "tool_linux_amd64", BrowserDownloadURL: "https://x/tool_linux_amd64", Size: mb},
+		{Name: "tool_linux_arm64.deb", BrowserDownloadURL: "https://x/tool_linux_arm64.deb", Size: mb},
+		{Name: "tool_darwin_arm64.tar.gz", BrowserDownloadURL: "https://x/tool_darwin_arm64.tar.gz", Size: mb},
+	}
+	assets, scores := DefaultWeights.match(Query{Program: "tool"}, ghas, nil, nil)
+	names := []string{}
+	for _, a := range assets {
+		names = append(names, a.Name)
+	}
+	// os/arch guesses lose to named assets, bare binaries beat zips
+	if len(names) != 2 || names[0] != "tool_darwin_arm64.tar.gz" || names[1] != "tool_linux_amd64" {
+		t.Fatalf("unexpected assets: %v", names)
+	}
+	if len(scores) != len(ghas) {
+		t.Fatalf("expected a score for every asset, got %d", len(scores))
+	}
+	for _, s := range scores {
+		if s.Selected != (s.Name == "tool_darwin_arm64.tar.gz" || s.Name == "tool_linux_amd64") {
+			t.Fatalf("unexpected selection: %+v", s)
+		}
+		if !s.Selected && s.Reason == "" {
+			t.Fatalf("expected a reason: %+v", s)
+		}
+	}
+	// other file types are kept for hosts which can't extract the best
+	if alts := assets[1].Alternatives; len(alts) != 1 || alts[0].Name != "tool_linux_amd64.zip" {
+		t.Fatalf("unexpected alternatives: %+v", alts)
+	}
+	if p := assets.Primary(); len(p[1].Alternatives) != 0 {
+		t.Fatalf("expected primary assets without alternatives: %+v", p)
+	}
+	// disk images and packages are replaced by other file types, or dropped
+	installers := Assets{
+		{Name: "tool.dmg", OS: "darwin", Arch: "arm64", Type: ".dmg", Alternatives: Assets{{Name: "tool.pkg", Type: ".pkg"}, {Name: "tool_darwin.zip", Type: ".zip"}}},
+		{Name: "tool.pkg", OS: "darwin", Arch: "amd64", Type: ".pkg"},
+		assets[1],
+	}
+	if e := installers.Extractable(); len(e) != 2 || e[0].Name != "tool_darwin.zip" || e[1].Name != "tool_linux_amd64" {
+		t.Fatalf("unexpected extractable assets: %+v", e)
+	}
+	if r := scores[0].Rules; r["source"] != DefaultWeights["source"] {
+		t.Fatalf("expected source penalty: %+v", scores[0])
+	}
+	// select is a hard filter
+	assets, _ = DefaultWeights.match(Query{Program: "tool", Select: ".zip"}, ghas, nil, nil)
+	if len(assets) != 1 || assets[0].Name != "tool_linux_amd64.zip" {
+		t.Fatalf("unexpected selected assets: %+v", assets)
+	}
+	// weights can change the outcome
+	w, _ := ParseWeights([]string{"type.zip=5"})
+	if assets, _ = w.match(Query{Program: "tool"}, ghas, nil, nil); assets[1].Name != "tool_linux_amd64.zip" {
+		t.Fatalf("expected zip to be preferred: %+v", assets)
+	}
+}
+
+func TestDebugScores(t *testing.T) {
+	h := &Handler{}
+	q := Query{User: "acme", Program: "tool", Release: "v1"}
+	h.cache = map[string]QueryResult{q.cacheKey(): {
+		Timestamp: time.Now(),
+		Query:     q,
+		Assets:    Assets{{Name: "tool_linux_amd64", OS: "linux", Arch: "amd64", Type: ".bin"}},
+		Scores:    []AssetScore{{Name: "tool_linux_amd64", Score: 11, Selected: true}},
+	}}
+	for target, expected := range map[string]int{
+		"/acme/tool@v1?type=json":         0,
+		"/acme/tool@v1?type=json&debug=1": 1,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		var result QueryResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("%s: %s", err, w.Body.String())
+		}
+		if len(result.Scores) != expected {
+			t.Fatalf("%s: expected %d scores, got %d", target, expected, len(result.Scores))
+		}
+	}
+}
+
+func TestMatchMacOS(t *testing.T) {
+	ghas := ghAssets{
+		{Name: "Tool.dmg", BrowserDownloadURL: "https://x/Tool.dmg", Size: 1024},
+		{Name: "tool-arm64.pkg", BrowserDownloadURL: "https://x/tool-arm64.pkg", Size: 1024},
+		{Name: "tool-freebsd-amd64.pkg", BrowserDownloadURL: "https://x/tool-freebsd-amd64.pkg", Size: 1024},
+	}
+	assets, scores := DefaultWeights.match(Query{Program: "tool"}, ghas, nil, nil)
+	if len(assets) != 2 || assets[0].Key() != "darwin/amd64" || assets[1].Key() != "darwin/arm64" {
+		t.Fatalf("expected macOS assets: %+v", assets)
+	}
+	if s := scores[2]; s.Selected || s.Reason == "" {
+		t.Fatalf("expected freebsd packages to be unsupported: %+v", s)
+	}
+}
@@ -32,7 +32,7 @@ var (
 	// for architecture detection, it is prefered to do a suffix match,
 	// so that example_i686.tar.gz can also be matched.
 
-	archReAmd64   = regexp.MustCompile(`(amd64|x86_64)(?:[^a-zA-Z0-9]|$)`)
+	archReAmd64   = regexp.MustCompile(`(amd64|x86_64)(?:v[2-4])?(?:[^a-zA-Z0-9]|$)`)
 	archRe386     = regexp.MustCompile(`(386|686|x86_32)(?:[^a-zA-Z0-9]|$)`)
 	archReArm64   = regexp.MustCompile(`(arm64|aarch64|aarch_64)(?:[^a-zA-Z0-9]|$)`)
 	archReArm     = regexp.MustCompile(`(arm(v[567]|32)?[eh]?[fl]?)(?:[^a-zA-Z0-9]|$)`)
@@ -48,8 +48,77 @@ var (
 	fuzzArch386   = regexp.MustCompile(`(x?32(bit)?|x86)\b`)
 )
 
+// arm variant patterns (debian armhf is armv7, armel is armv5),
+// rust targets without a version (arm-unknown-linux-gnueabihf) are armv6
+var (
+	armReVersion = regexp.MustCompile(`armv([5-7])`)
+	armReHF      = regexp.MustCompile(`armhf`)
+	armReEL      = regexp.MustCompile(`armel`)
+	armReRust    = regexp.MustCompile(`arm-.*eabi`)
+)
+
+// x86-64 microarchitecture levels (e.g. x86_64_v3), v1 is the baseline
+var amd64ReLevel = regexp.MustCompile(`(?:amd64|x86_64)[_\-]?v([2-4])(?:[^a-zA-Z0-9]|$)`)
+
+// libc patterns, also matching the arm abi suffixes (e.g. musleabihf, gnueabihf)
+var (
+	libcReMusl = regexp.MustCompile(`musl`)
+	libcReGnu  = regexp.MustCompile(`(?:[^a-zA-Z0-9]|^)(gnu|glibc)`)
+)
+
 var (
 	checksumRe     = regexp.MustCompile(`(checksums|sha256sums)`)
-	fileExtRe      = regexp.MustCompile(`(\.tar)?(\.[a-z][a-z0-9]+)$`)
+	fileExtRe      = regexp.MustCompile(`(\.tar)?(\.[a-z][a-z0-9]+|\.7z|\.AppImage)$`)
 	searchGithubRe = regexp.MustCompile(`https:\/\/github\.com\/(\w+)\/(\w+)`)
+	// absolute, relative or home (~/) directories without shell meta characters
+	safeDirRe = regexp.MustCompile(`^(~|~\/[\w\.\-\/+@]*|[\w\.\/+@][\w\.\-\/+@]*)$`)
+)
+
+// uploaded lockfile fields, which are embedded in the script
+var (
+	lockNameRe    = regexp.MustCompile(`^[\w\.\-+@]+$`)
+	lockTagRe     = regexp.MustCompile(`^[\w\.\-+@\/]+$`)
+	lockURLRe     = regexp.MustCompile(`^https:\/\/[\w\.\-\/~%+@:=?&]+$`)
+	lockTypeRe    = regexp.MustCompile(`^(\.tar)?(\.[a-z][a-z0-9]+|\.7z|\.AppImage)$`)
+	sha256Re      = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	lockVariantRe = regexp.MustCompile(`^v\d$`)
+	lockLibcRe    = regexp.MustCompile(`^(gnu|musl)$`)
+	lockQueryRe   = regexp.MustCompile(`^[\w\.\-+]+\/[\w\.\-+]+(@[\w\.\-+\/]+)?$`)
 )
+
+// bundle queries, which are echoed by the script
+var bundleNameRe = regexp.MustCompile(`[^\w\.\-+@\/!]`)
+
+// search candidates (repositories and tags), which are echoed by the script
+var candidateRe = regexp.MustCompile(`[^\w\.\-\/]`)
+
+// <user>/<repo>@<release> routes (the user and release are optional)
+var routeRe = regexp.MustCompile(`^\/([\w\-]+\/)?[\w\.\-]+(@[\w\.\-+\/]+)?$`)
+
+// binary names, which are embedded in install scripts
+var binNameRe = regexp.MustCompile(`^[\w\.\-+]+$`)
+
+// characters which are not allowed in dockerfile build stage names
+var stageNameRe = regexp.MustCompile(`[^a-z0-9\-_\.]`)
+
+// inspected binary paths inside release assets, also embedded in install scripts
+var binPathRe = regexp.MustCompile(`^[\w\-+@][\w\.\-+@]*(\/[\w\-+@][\w\.\-+@]*)*$`)
+
+// source build packages (go package paths and cargo crate names), embedded in the script
+var (
+	goModuleRe  = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+	goPackageRe = regexp.MustCompile(`^[\w\-~][\w\.\-~]*(\/[\w\-~][\w\.\-~]*)*$`)
+	crateNameRe = regexp.MustCompile(`^[A-Za-z0-9][\w\-]*$`)
+)
+
+// release metadata patterns, rust target triples (e.g. x86_64-unknown-linux-musl)
+// and cargo-binstall template variables (e.g. { target })
+var (
+	rustTargetRe    = regexp.MustCompile(`-(unknown|apple|pc)-(linux|darwin|windows|freebsd|netbsd|illumos)`)
+	binstallVarRe   = regexp.MustCompile(`\{\s*([\w\-]+)\s*\}`)
+	binstallTarget  = `([a-z0-9_]+(?:-[a-z0-9_\.]+)+)`
+	goreleaserSumRe = regexp.MustCompile(`^sha256:([0-9a-f]{64})$`)
+)
+
+// server urls, embedded in the verify script
+var baseURLRe = regexp.MustCompile(`^https?:\/\/[\w\.\-:\[\]]+$`)
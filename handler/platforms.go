@@ -0,0 +1,51 @@
+package handler
+
+// nix system doubles for each asset key
+var nixSystems = map[string]string{
+	"darwin/amd64":  "x86_64-darwin",
+	"darwin/arm64":  "aarch64-darwin",
+	"freebsd/386":   "i686-freebsd",
+	"freebsd/amd64": "x86_64-freebsd",
+	"linux/386":     "i686-linux",
+	"linux/amd64":   "x86_64-linux",
+	"linux/arm":     "armv7l-linux",
+	"linux/arm64":   "aarch64-linux",
+	"linux/loong64": "loongarch64-linux",
+	"linux/ppc64le": "powerpc64le-linux",
+	"linux/riscv64": "riscv64-linux",
+	"linux/s390x":   "s390x-linux",
+}
+
+// nixpkgs providing the decompressor of each file type,
+// which stdenv doesn't include
+var nixInputs = map[string]string{
+	".7z":      "p7zip",
+	".lz4":     "lz4",
+	".tar.lz":  "lzip",
+	".tar.lz4": "lz4",
+	".tar.zst": "zstd",
+	".zst":     "zstd",
+}
+
+// ansible_system fact for each asset os
+var ansibleSystems = map[string]string{
+	"darwin":  "Darwin",
+	"freebsd": "FreeBSD",
+	"linux":   "Linux",
+	"netbsd":  "NetBSD",
+	"openbsd": "OpenBSD",
+}
+
+// ansible_architecture facts for each asset arch,
+// which vary by operating system (e.g. aarch64 vs arm64)
+var ansibleArchs = map[string][]string{
+	"386":     {"i386", "i686"},
+	"amd64":   {"x86_64", "amd64"},
+	"arm":     {"armv7l", "armv6l"},
+	"arm64":   {"aarch64", "arm64"},
+	"loong64": {"loongarch64"},
+	"mips64":  {"mips64"},
+	"ppc64le": {"ppc64le"},
+	"riscv64": {"riscv64"},
+	"s390x":   {"s390x"},
+}
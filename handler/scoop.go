@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// scoop architecture names for each windows asset arch
+var scoopArchs = map[string]string{
+	"amd64": "64bit",
+	"386":   "32bit",
+	"arm64": "arm64",
+}
+
+type scoopManifest struct {
+	Version      string               `json:"version"`
+	Description  string               `json:"description"`
+	Homepage     string               `json:"homepage"`
+	Architecture map[string]scoopArch `json:"architecture"`
+	Checkver     scoopCheckver        `json:"checkver"`
+	Autoupdate   scoopAutoupdate      `json:"autoupdate"`
+	Notes        string               `json:"notes,omitempty"`
+}
+
+type scoopArch struct {
+	URL        string   `json:"url"`
+	Hash       string   `json:"hash,omitempty"`
+	ExtractDir string   `json:"extract_dir,omitempty"`
+	Bin        any      `json:"bin"` // file name, or [[file name, shim name]]
+	PreInstall []string `json:"pre_install,omitempty"`
+}
+
+type scoopCheckver struct {
+	URL      string `json:"url"`
+	JSONPath string `json:"jsonpath"`
+	Regex    string `json:"regex"`
+}
+
+type scoopAutoupdate struct {
+	Architecture map[string]scoopAutoupdateArch `json:"architecture"`
+}
+
+type scoopAutoupdateArch struct {
+	URL        string    `json:"url"`
+	Hash       scoopHash `json:"hash"`
+	ExtractDir string    `json:"extract_dir,omitempty"`
+}
+
+type scoopHash struct {
+	URL      string `json:"url"`
+	JSONPath string `json:"jsonpath"`
+}
+
+// newScoopManifest converts the windows assets of a result into a scoop
+// app manifest. checkver and autoupdate point back at this installer
+// (baseURL), which also provides the hashes of future releases.
+func newScoopManifest(result QueryResult, baseURL string) (*scoopManifest, error) {
+	repo := result.User + "/" + result.Program
+	version := result.Version()
+	// the release tag, with the version replaced by scoop's variable
+	tag := strings.Replace(result.ResolvedRelease, version, "$version", 1)
+	m := &scoopManifest{
+		Version:      version,
+		Description:  fmt.Sprintf("%s release binary from github.com/%s", result.Program, repo),
+		Homepage:     "https://github.com/" + repo,
+		Architecture: map[string]scoopArch{},
+		Checkver: scoopCheckver{
+			URL:      fmt.Sprintf("%s/%s?type=json", baseURL, repo),
+			JSONPath: "$.ResolvedRelease",
+			Regex:    `v?([\d.]+)`,
+		},
+		Autoupdate: scoopAutoupdate{
+			Architecture: map[string]scoopAutoupdateArch{},
+		},
+		Notes: "installed using https://github.com/jpillora/installer",
+	}
+	for _, a := range result.Assets {
+		arch, ok := scoopArchs[a.Arch]
+		if a.OS != "windows" || !ok {
+			continue
+		}
+		if _, exists := m.Architecture[arch]; exists {
+			continue
+		}
+		exe := result.ProgramName() + ".exe"
+		url := a.URL
+		sa := scoopArch{Hash: a.SHA256, Bin: exe}
+		// rename downloads with a url fragment, so executables
+		// and single file archives end up as <program>.exe
+		switch a.Type {
+		case ".exe", ".bin":
+			url += "#/" + exe
+		case ".gz", ".bz2":
+			url += "#/" + exe + a.Type
+		default:
+			if a.BinPath != "" {
+				// the binary path is known, extract its directory
+				// and shim the binary under the program name
+				if dir := path.Dir(a.BinPath); dir != "." {
+					sa.ExtractDir = dir
+				}
+				if name := path.Base(a.BinPath); name != exe {
+					sa.Bin = [][]string{{name, result.ProgramName()}}
+				}
+			} else {
+				sa.PreInstall = scoopFindBinary(result, exe)
+			}
+		}
+		sa.URL = url
+		m.Architecture[arch] = sa
+		m.Autoupdate.Architecture[arch] = scoopAutoupdateArch{
+			URL:        strings.ReplaceAll(url, version, "$version"),
+			ExtractDir: strings.ReplaceAll(sa.ExtractDir, version, "$version"),
+			Hash: scoopHash{
+				URL:      fmt.Sprintf("%s/%s@%s?type=scoop", baseURL, repo, tag),
+				JSONPath: fmt.Sprintf("$.architecture.%s.hash", arch),
+			},
+		}
+	}
+	if len(m.Architecture) == 0 {
+		return nil, fmt.Errorf("no windows assets found for %s", repo)
+	}
+	return m, nil
+}
+
+// scoopFindBinary is a pre_install script which moves the binary out of an
+// archive with an unknown layout to <dir>/<exe>: the binary named by ?bin=
+// or <program>.exe, otherwise the largest executable
+func scoopFindBinary(result QueryResult, exe string) []string {
+	name := result.Program + ".exe"
+	if result.Bin != "" {
+		name = strings.TrimSuffix(result.Bin, ".exe") + ".exe"
+	}
+	return []string{
+		fmt.Sprintf(`$bin = Get-ChildItem "$dir" -Recurse -File -Filter '%s' | Select-Object -First 1`, name),
+		`if (!$bin) { $bin = Get-ChildItem "$dir" -Recurse -File -Filter '*.exe' | Sort-Object Length -Descending | Select-Object -First 1 }`,
+		fmt.Sprintf(`if ($bin -and $bin.FullName -ne "$dir\%s") { Move-Item $bin.FullName "$dir\%s" -Force }`, exe, exe),
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestScoopManifestArchives(t *testing.T) {
+	result := QueryResult{
+		Query:           Query{User: "acme", Program: "tool"},
+		ResolvedRelease: "v1.2.0",
+		Assets: Assets{
+			{OS: "windows", Arch: "amd64", Type: ".zip", URL: "https://x/tool_1.2.0_windows_amd64.zip", BinPath: "tool_1.2.0_windows_amd64/tool.exe"},
+			{OS: "windows", Arch: "386", Type: ".zip", URL: "https://x/tool_1.2.0_windows_386.zip"},
+			{OS: "windows", Arch: "arm64", Type: ".zip", URL: "https://x/tool_1.2.0_windows_arm64.zip", BinPath: "bin/tool-cli.exe"},
+		},
+	}
+	m, err := newScoopManifest(result, "https://i.jpillora.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// known binary path: extract its directory
+	if a := m.Architecture["64bit"]; a.ExtractDir != "tool_1.2.0_windows_amd64" || a.Bin != "tool.exe" || a.PreInstall != nil {
+		t.Fatalf("unexpected 64bit: %+v", a)
+	}
+	if dir := m.Autoupdate.Architecture["64bit"].ExtractDir; dir != "tool_$version_windows_amd64" {
+		t.Fatalf("unexpected autoupdate extract_dir %q", dir)
+	}
+	// unknown layout: find the binary before install
+	if a := m.Architecture["32bit"]; a.ExtractDir != "" || a.Bin != "tool.exe" || len(a.PreInstall) == 0 || !strings.Contains(a.PreInstall[0], "'tool.exe'") {
+		t.Fatalf("unexpected 32bit: %+v", a)
+	}
+	// differently named binary: shimmed as the program
+	b, _ := json.Marshal(m.Architecture["arm64"])
+	if !strings.Contains(string(b), `"extract_dir":"bin","bin":[["tool-cli.exe","tool"]]`) {
+		t.Fatalf("unexpected arm64: %s", b)
+	}
+}
@@ -3,34 +3,238 @@ package handler
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
-func imFeelingLuck(phrase string) (user, project string, err error) {
-	phrase += " site:github.com"
-	// try dgg
+const (
+	searchTTL = 24 * time.Hour
+	// maximum number of search results checked for release assets
+	maxSearchCandidates = 5
+)
+
+// SearchResult is a github repository found by a Searcher
+type SearchResult struct {
+	User, Program string
+	Stars         int
+}
+
+// Searcher finds github repositories matching a search phrase,
+// with the most relevant repository first
+type Searcher interface {
+	Search(phrase string) ([]SearchResult, error)
+}
+
+type searchEntry struct {
+	results   []SearchResult
+	timestamp time.Time
+}
+
+// searchers used by the handler, defaults to github repository
+// search, falling back to web search (im feeling lucky) scrapers
+func (h *Handler) searchers() []Searcher {
+	if h.Searchers != nil {
+		return h.Searchers
+	}
+	return []Searcher{
+		&GithubSearcher{Handler: h},
+		DuckDuckGoSearcher{},
+		GoogleSearcher{},
+	}
+}
+
+// search runs a searcher, results are cached by searcher and phrase
+func (h *Handler) search(s Searcher, phrase string) ([]SearchResult, error) {
+	key := fmt.Sprintf("%T:%s", s, phrase)
+	h.searchMut.Lock()
+	cached, ok := h.searches[key]
+	h.searchMut.Unlock()
+	if ok && time.Since(cached.timestamp) < searchTTL {
+		return cached.results, nil
+	}
+	results, err := s.Search(phrase)
+	if err != nil {
+		return nil, err
+	}
+	h.searchMut.Lock()
+	if h.searches == nil {
+		h.searches = map[string]searchEntry{}
+	}
+	h.searches[key] = searchEntry{results: results, timestamp: time.Now()}
+	h.searchMut.Unlock()
+	return results, nil
+}
+
+// SearchCandidate is a search result, and whether
+// its release has assets which can be installed
+type SearchCandidate struct {
+	User, Program string
+	Stars         int
+	Release       string
+	Compatible    bool
+}
+
+// searchAssets searches for the repository of q.Program, returning
+// the first result with a release containing binary assets. when
+// the match is weak (the repository name differs from the program)
+// the top search results are also returned as candidates.
+func (h *Handler) searchAssets(q Query) (QueryResult, error) {
+	for _, s := range h.searchers() {
+		results, err := h.search(s, q.Program)
+		if err != nil {
+			log.Printf("search failed: %T: %s", s, err)
+			continue
+		}
+		if len(results) > maxSearchCandidates {
+			results = results[:maxSearchCandidates]
+		}
+		var (
+			candidates = []SearchCandidate{}
+			match      *QueryResult
+		)
+		for _, r := range results {
+			c := QueryResult{Query: q}
+			c.User = r.User
+			c.Program = r.Program
+			c.ResolvedRelease, c.Assets, c.Scores, err = h.getAssetsNoCache(c.Query)
+			candidates = append(candidates, SearchCandidate{
+				User:       r.User,
+				Program:    r.Program,
+				Stars:      r.Stars,
+				Release:    c.ResolvedRelease,
+				Compatible: err == nil,
+			})
+			if err != nil {
+				log.Printf("search result %s/%s skipped: %s", r.User, r.Program, err)
+				continue
+			}
+			// weak match found, only collecting candidates
+			if match != nil {
+				continue
+			}
+			log.Printf("search found: %s/%s", r.User, r.Program)
+			if strings.EqualFold(r.Program, q.Program) {
+				return c, nil
+			}
+			log.Printf("program mismatch: got %s: expected %s", q.Program, r.Program)
+			match = &c
+		}
+		if match != nil {
+			match.Candidates = candidates
+			return *match, nil
+		}
+	}
+	return QueryResult{}, fmt.Errorf("%w: no repository with release assets found for '%s'", errNotFound, q.Program)
+}
+
+// ambiguousScript is served instead of an install script
+// when the search match is weak, unless confirmed
+func ambiguousScript(r QueryResult) string {
+	// prevent shell injection
+	clean := func(s string) string {
+		return candidateRe.ReplaceAllString(s, "")
+	}
+	b := strings.Builder{}
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "echo 'No repository named %s was found, did you mean:'\n", clean(r.Searched))
+	for _, c := range r.Candidates {
+		status := "no compatible assets"
+		if c.Compatible {
+			status = clean(c.Release)
+		}
+		fmt.Fprintf(&b, "echo '  %s/%s (%d stars, %s)'\n", clean(c.User), clean(c.Program), c.Stars, status)
+	}
+	b.WriteString("echo 'Use <user>/<repo> to choose one, or append ?confirm=1 to install the first compatible repository'\n")
+	b.WriteString("exit 1\n")
+	return b.String()
+}
+
+// GithubSearcher uses the github repository search API,
+// exact name matches first, then by number of stars
+type GithubSearcher struct {
+	Handler *Handler
+}
+
+func (s *GithubSearcher) Search(phrase string) ([]SearchResult, error) {
 	v := url.Values{}
-	v.Set("q", "! " /*I'm feeling lucky*/ +phrase)
-	if user, project, err := captureRepoLocation(("https://html.duckduckgo.com/html?" + v.Encode())); err == nil {
-		return user, project, nil
+	v.Set("q", phrase+" in:name fork:false")
+	v.Set("sort", "stars")
+	v.Set("order", "desc")
+	v.Set("per_page", "10")
+	resp := ghSearchResponse{}
+	if err := s.Handler.get("https://api.github.com/search/repositories?"+v.Encode(), &resp); err != nil {
+		return nil, err
 	}
-	// try google
-	v = url.Values{}
-	v.Set("btnI", "") // I'm feeling lucky
-	v.Set("q", phrase)
-	if user, project, err := captureRepoLocation(("https://www.google.com/search?" + v.Encode())); err == nil {
-		return user, project, nil
+	results := []SearchResult{}
+	for _, r := range resp.Items {
+		if r.Archived {
+			continue
+		}
+		results = append(results, SearchResult{
+			User:    r.Owner.Login,
+			Program: r.Name,
+			Stars:   r.StargazersCount,
+		})
+	}
+	rankSearchResults(phrase, results)
+	return results, nil
+}
+
+// rankSearchResults moves exact name matches to the front,
+// otherwise the most starred repositories are first
+func rankSearchResults(phrase string, results []SearchResult) {
+	exact := func(r SearchResult) bool {
+		return strings.EqualFold(r.Program, phrase)
 	}
-	return "", "", errors.New("not found")
+	sort.SliceStable(results, func(i, j int) bool {
+		if exact(results[i]) != exact(results[j]) {
+			return exact(results[i])
+		}
+		return results[i].Stars > results[j].Stars
+	})
+}
+
+type ghSearchResponse struct {
+	TotalCount int `json:"total_count"`
+	Items      []struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+		StargazersCount int  `json:"stargazers_count"`
+		Archived        bool `json:"archived"`
+	} `json:"items"`
+}
+
+// DuckDuckGoSearcher scrapes the duckduckgo "I'm feeling lucky" redirect
+type DuckDuckGoSearcher struct{}
+
+func (DuckDuckGoSearcher) Search(phrase string) ([]SearchResult, error) {
+	v := url.Values{}
+	v.Set("q", "! " /*I'm feeling lucky*/ +phrase+" site:github.com")
+	return captureRepoLocation("https://html.duckduckgo.com/html?" + v.Encode())
+}
+
+// GoogleSearcher scrapes the google "I'm feeling lucky" redirect
+type GoogleSearcher struct{}
+
+func (GoogleSearcher) Search(phrase string) ([]SearchResult, error) {
+	v := url.Values{}
+	v.Set("btnI", "") // I'm feeling lucky
+	v.Set("q", phrase+" site:github.com")
+	return captureRepoLocation("https://www.google.com/search?" + v.Encode())
 }
 
 // uses im feeling lucky and grabs the "Location"
 // header from the 302, which contains the github repo
-func captureRepoLocation(url string) (user, project string, err error) {
+func captureRepoLocation(url string) ([]SearchResult, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	req.Header.Set("Accept", "*/*")
 	// I'm a browser... :)
@@ -38,20 +242,18 @@ func captureRepoLocation(url string) (user, project string, err error) {
 	// roundtripper doesn't follow redirects
 	resp, err := http.DefaultTransport.RoundTrip(req)
 	if err != nil {
-		return "", "", fmt.Errorf("request failed: %s", err)
+		return nil, fmt.Errorf("request failed: %s", err)
 	}
 	resp.Body.Close()
 	// assume redirection
 	if resp.StatusCode/100 != 3 {
-		return "", "", fmt.Errorf("non-redirect response: %d", resp.StatusCode)
+		return nil, fmt.Errorf("non-redirect response: %d", resp.StatusCode)
 	}
 	// extract Location header URL
 	loc := resp.Header.Get("Location")
 	m := searchGithubRe.FindStringSubmatch(loc)
 	if len(m) == 0 {
-		return "", "", fmt.Errorf("github url not found in redirect: %s", loc)
+		return nil, errors.New("github url not found in redirect: " + loc)
 	}
-	user = m[1]
-	project = m[2]
-	return user, project, nil
+	return []SearchResult{{User: m[1], Program: m[2]}}, nil
 }
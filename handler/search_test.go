@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSearcher struct {
+	results []SearchResult
+	err     error
+	calls   int
+}
+
+func (s *testSearcher) Search(phrase string) ([]SearchResult, error) {
+	s.calls++
+	return s.results, s.err
+}
+
+func TestRankSearchResults(t *testing.T) {
+	results := []SearchResult{
+		{User: "a", Program: "jq-web", Stars: 900},
+		{User: "b", Program: "gojq", Stars: 3000},
+		{User: "jqlang", Program: "jq", Stars: 30000},
+		{User: "c", Program: "JQ", Stars: 10},
+	}
+	rankSearchResults("jq", results)
+	for i, want := range []string{"jqlang/jq", "c/JQ", "b/gojq", "a/jq-web"} {
+		if got := results[i].User + "/" + results[i].Program; got != want {
+			t.Fatalf("result %d = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	h := &Handler{}
+	s := &testSearcher{results: []SearchResult{{User: "jqlang", Program: "jq"}}}
+	for i := 0; i < 3; i++ {
+		results, err := h.search(s, "jq")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].User != "jqlang" {
+			t.Fatalf("unexpected search results: %+v", results)
+		}
+	}
+	if s.calls != 1 {
+		t.Fatalf("expected search results to be cached, got %d searches", s.calls)
+	}
+	// errors are not cached
+	failing := &testSearcher{err: errors.New("rate limited")}
+	for i := 0; i < 2; i++ {
+		if _, err := h.search(failing, "fzf"); err == nil {
+			t.Fatalf("expected search error")
+		}
+	}
+	if failing.calls != 2 {
+		t.Fatalf("expected search errors not to be cached, got %d searches", failing.calls)
+	}
+}
+
+func TestSearchAssetsNotFound(t *testing.T) {
+	s := &testSearcher{}
+	h := &Handler{Searchers: []Searcher{&testSearcher{err: errors.New("down")}, s}}
+	_, err := h.searchAssets(Query{Program: "nothing"})
+	if !errors.Is(err, errNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if s.calls != 1 {
+		t.Fatalf("expected fallback searcher to be used")
+	}
+}
+
+func TestAmbiguousSearch(t *testing.T) {
+	q := Query{Program: "jqq", Release: "latest", Search: true}
+	found := q
+	found.User = "jqlang"
+	found.Program = "jq"
+	h := &Handler{cache: map[string]QueryResult{
+		q.cacheKey(): {
+			Query:           found,
+			ResolvedRelease: "jq-1.8.1",
+			Timestamp:       time.Now(),
+			Assets:          Assets{{Name: "jq-linux-amd64", OS: "linux", Arch: "amd64", URL: "https://github.com/jqlang/jq/releases/download/jq-1.8.1/jq-linux-amd64", Type: ".bin"}},
+			Searched:        "jqq",
+			Candidates: []SearchCandidate{
+				{User: "jqlang", Program: "jq", Stars: 30000, Release: "jq-1.8.1", Compatible: true},
+				{User: "someone", Program: "jqq-web", Stars: 5},
+			},
+		},
+	}}
+	get := func(target string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w.Body.String()
+	}
+	script := get("/jqq?type=script")
+	for _, want := range []string{"No repository named jqq", "jqlang/jq (30000 stars, jq-1.8.1)", "someone/jqq-web (5 stars, no compatible assets)", "exit 1"} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("expected ambiguous script to contain %q", want)
+		}
+	}
+	if script := get("/jqq?type=script&confirm=1"); !strings.Contains(script, `PROG="jq"`) {
+		t.Fatalf("expected confirmed search to install jq")
+	}
+	if text := get("/jqq?type=text"); !strings.Contains(text, "search-candidates:") {
+		t.Fatalf("expected text to list search candidates")
+	}
+	if json := get("/jqq?type=json"); !strings.Contains(json, `"Candidates": [`) {
+		t.Fatalf("expected json to list search candidates")
+	}
+}
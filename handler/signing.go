@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/jpillora/installer/scripts"
+)
+
+// signatureNamespace prevents installer signatures being used for
+// other purposes, clients verify with: ssh-keygen -Y verify -n installer
+const signatureNamespace = "installer"
+
+// Signer signs installer responses with an ed25519 SSH signature (SSHSIG)
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner signs using the given key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key}
+}
+
+// LoadSigner reads an unencrypted OpenSSH ed25519 private key file
+// (ssh-keygen -t ed25519 -N ""), returning nil when path is empty
+func LoadSigner(path string) (*Signer, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	return ParseSigner(b)
+}
+
+// ParseSigner parses an unencrypted OpenSSH ed25519 private key
+func ParseSigner(pemBytes []byte) (*Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return nil, errors.New("signing key: expected an OPENSSH PRIVATE KEY")
+	}
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(block.Bytes, []byte(magic)) {
+		return nil, errors.New("signing key: unknown format")
+	}
+	r := &sshReader{b: block.Bytes[len(magic):]}
+	cipher, kdf := r.string(), r.string()
+	r.string() // kdf options
+	if string(cipher) != "none" || string(kdf) != "none" {
+		return nil, errors.New("signing key: encrypted keys are not supported")
+	}
+	if n := r.uint32(); n != 1 {
+		return nil, fmt.Errorf("signing key: expected 1 key, found %d", n)
+	}
+	r.string() // public key
+	priv := &sshReader{b: r.string()}
+	if r.err != nil {
+		return nil, r.err
+	}
+	// matching check integers, then the key
+	if check1, check2 := priv.uint32(), priv.uint32(); check1 != check2 {
+		return nil, errors.New("signing key: corrupt key")
+	}
+	if keyType := string(priv.string()); keyType != "ssh-ed25519" {
+		return nil, fmt.Errorf("signing key: only ed25519 keys are supported (found %s)", keyType)
+	}
+	priv.string() // public key
+	key := priv.string()
+	if priv.err != nil {
+		return nil, priv.err
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("signing key: invalid ed25519 key")
+	}
+	return NewSigner(ed25519.PrivateKey(key)), nil
+}
+
+// PublicKey in the OpenSSH authorized_keys format
+func (s *Signer) PublicKey() string {
+	return "ssh-ed25519 " + base64.StdEncoding.EncodeToString(s.publicKeyBlob()) + " " + signatureNamespace
+}
+
+func (s *Signer) publicKeyBlob() []byte {
+	blob := appendSSHString(nil, []byte("ssh-ed25519"))
+	return appendSSHString(blob, s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign returns the SSH signature (SSHSIG) of data, base64 encoded without
+// the armor (see armorSignature), as sent in the X-Installer-Signature header
+func (s *Signer) Sign(data []byte) string {
+	hash := sha512.Sum512(data)
+	signed := []byte("SSHSIG")
+	signed = appendSSHString(signed, []byte(signatureNamespace))
+	signed = appendSSHString(signed, nil) // reserved
+	signed = appendSSHString(signed, []byte("sha512"))
+	signed = appendSSHString(signed, hash[:])
+	sig := appendSSHString(nil, []byte("ssh-ed25519"))
+	sig = appendSSHString(sig, ed25519.Sign(s.key, signed))
+	blob := []byte("SSHSIG")
+	blob = binary.BigEndian.AppendUint32(blob, 1) // version
+	blob = appendSSHString(blob, s.publicKeyBlob())
+	blob = appendSSHString(blob, []byte(signatureNamespace))
+	blob = appendSSHString(blob, nil)
+	blob = appendSSHString(blob, []byte("sha512"))
+	blob = appendSSHString(blob, sig)
+	return base64.StdEncoding.EncodeToString(blob)
+}
+
+// armorSignature wraps a signature as a .sig file, for ssh-keygen -Y verify -s
+func armorSignature(sig string) string {
+	b := strings.Builder{}
+	b.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(sig) > 70 {
+		b.WriteString(sig[:70] + "\n")
+		sig = sig[70:]
+	}
+	b.WriteString(sig + "\n-----END SSH SIGNATURE-----\n")
+	return b.String()
+}
+
+func appendSSHString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// sshReader reads the SSH wire format, the first error is kept
+type sshReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.err = errors.New("signing key: truncated key")
+		return 0
+	}
+	n := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return n
+}
+
+func (r *sshReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.b)) < n {
+		r.err = errors.New("signing key: truncated key")
+		return nil
+	}
+	s := r.b[:n]
+	r.b = r.b[n:]
+	return s
+}
+
+// bufferedResponse captures a response so it can be signed
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	b.code = code
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// serveSigned signs successful responses, the signature is sent in
+// the X-Installer-Signature header, or as the response to <url>.sig
+func (h *Handler) serveSigned(w http.ResponseWriter, r *http.Request) {
+	sigFile := strings.HasSuffix(r.URL.Path, ".sig")
+	if sigFile {
+		r = r.Clone(r.Context())
+		r.URL.Path = strings.TrimSuffix(r.URL.Path, ".sig")
+	}
+	resp := &bufferedResponse{header: http.Header{}, code: http.StatusOK}
+	h.serve(resp, r)
+	for k, v := range resp.header {
+		w.Header()[k] = v
+	}
+	if resp.code != http.StatusOK {
+		w.WriteHeader(resp.code)
+		w.Write(resp.body.Bytes())
+		return
+	}
+	sig := h.Signer.Sign(signedMessage(r, resp.body.Bytes()))
+	if sigFile {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(armorSignature(sig)))
+		return
+	}
+	w.Header().Set("X-Installer-Signature", sig)
+	w.Write(resp.body.Bytes())
+}
+
+// signedMessage is the request (path and query) on its own line, then the
+// response body, so a signed response can't be swapped for the response
+// of another tool, version or format
+func signedMessage(r *http.Request, body []byte) []byte {
+	return append([]byte(r.URL.RequestURI()+"\n"), body...)
+}
+
+// serveVerify responds with the signing public key, or with
+// a script which verifies installer scripts before printing them
+func (h *Handler) serveVerify(w http.ResponseWriter, r *http.Request) {
+	if h.Signer == nil {
+		http.Error(w, "script signing is not enabled on this server", http.StatusNotFound)
+		return
+	}
+	if r.URL.Path == "/signing-key.pub" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(h.Signer.PublicKey() + "\n"))
+		return
+	}
+	// prevent shell injection, the host is embedded in the script
+	base := baseURL(r)
+	if !baseURLRe.MatchString(base) {
+		http.Error(w, "Invalid host", http.StatusBadRequest)
+		return
+	}
+	t, err := template.New("verify").Parse(string(scripts.Verify))
+	if err != nil {
+		http.Error(w, "installer BUG: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		BaseURL, PublicKey, Namespace string
+	}{
+		BaseURL:   base,
+		PublicKey: h.Signer.PublicKey(),
+		Namespace: signatureNamespace,
+	}
+	w.Header().Set("Content-Type", "text/x-shellscript")
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
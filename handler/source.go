@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// Source is a build from source, used when a release has
+// no binary assets and the query allows it (?source=1)
+type Source struct {
+	Toolchain string // go or cargo
+	Package   string // go package path or cargo crate name
+	Command   string // build command, shown to the user
+}
+
+type ghContent struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+// getRepoFile fetches a file from the repository at the given tag
+func (h *Handler) getRepoFile(q Query, tag, path string) (string, error) {
+	u := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s?ref=%s", q.User, q.Program, path, url.QueryEscape(tag))
+	c := ghContent{}
+	if err := h.get(u, &c); err != nil {
+		return "", err
+	}
+	if c.Type != "file" || c.Encoding != "base64" {
+		return "", fmt.Errorf("unexpected %s content (type '%s', encoding '%s')", path, c.Type, c.Encoding)
+	}
+	b, err := base64.StdEncoding.DecodeString(c.Content)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s content: %w", path, err)
+	}
+	return string(b), nil
+}
+
+// getSource detects a go module or rust crate in the repository at
+// the given tag, returning the command used to build it from source
+func (h *Handler) getSource(q Query, tag string) (*Source, error) {
+	// prevent shell injection, the tag is embedded in the script
+	if !lockTagRe.MatchString(tag) {
+		return nil, fmt.Errorf("invalid release tag '%s'", tag)
+	}
+	s, err := h.goSource(q, tag)
+	if errors.Is(err, errNotFound) {
+		s, err = h.cargoSource(q, tag)
+	}
+	if errors.Is(err, errNotFound) {
+		return nil, errors.New("no assets found, and no go.mod or Cargo.toml to build from source")
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("building %s/%s@%s from source: %s", q.User, q.Program, tag, s.Command)
+	return s, nil
+}
+
+// goSource installs the module's cmd/<program> package if it
+// exists, otherwise the module root (go install <package>@<tag>)
+func (h *Handler) goSource(q Query, tag string) (*Source, error) {
+	gomod, err := h.getRepoFile(q, tag, "go.mod")
+	if err != nil {
+		return nil, err
+	}
+	m := goModuleRe.FindStringSubmatch(gomod)
+	if m == nil {
+		return nil, errors.New("go.mod has no module directive")
+	}
+	pkg := m[1]
+	dir := []ghContent{}
+	u := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/cmd/%s?ref=%s", q.User, q.Program, q.Program, url.QueryEscape(tag))
+	if err := h.get(u, &dir); err == nil {
+		pkg += "/cmd/" + q.Program
+	} else if !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+	if !goPackageRe.MatchString(pkg) {
+		return nil, fmt.Errorf("invalid go package '%s'", pkg)
+	}
+	return &Source{
+		Toolchain: "go",
+		Package:   pkg,
+		Command:   "go install " + pkg + "@" + tag,
+	}, nil
+}
+
+// cargoSource installs the Cargo.toml package, workspaces
+// are assumed to contain a crate named after the program
+func (h *Handler) cargoSource(q Query, tag string) (*Source, error) {
+	toml, err := h.getRepoFile(q, tag, "Cargo.toml")
+	if err != nil {
+		return nil, err
+	}
+	crate := cargoPackage(toml)
+	if crate == "" {
+		crate = q.Program
+	}
+	if !crateNameRe.MatchString(crate) {
+		return nil, fmt.Errorf("invalid crate name '%s'", crate)
+	}
+	return &Source{
+		Toolchain: "cargo",
+		Package:   crate,
+		Command:   fmt.Sprintf("cargo install --locked --git https://github.com/%s/%s --tag %s %s", q.User, q.Program, tag, crate),
+	}, nil
+}
+
+// cargoPackage is the [package] name of a Cargo.toml,
+// empty for virtual workspaces
+func cargoPackage(toml string) string {
+	return tomlTables(toml)["package"]["name"]
+}
+
+// tomlTables is a minimal TOML reader, returning the single line
+// string and scalar values of each table (inline tables and arrays
+// are returned as is). Quoted table names are unquoted.
+func tomlTables(toml string) map[string]map[string]string {
+	tables := map[string]map[string]string{"": {}}
+	table := ""
+	for _, line := range strings.Split(toml, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			table = strings.NewReplacer("[", "", "]", "", `"`, "", "'", "").Replace(line)
+			table = strings.TrimSpace(table)
+			if tables[table] == nil {
+				tables[table] = map[string]string{}
+			}
+			continue
+		}
+		key, value := splitHalf(line, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if key == "" || value == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		// quoted strings, ignoring trailing comments
+		if q := value[0]; q == '"' || q == '\'' {
+			if end := strings.IndexByte(value[1:], q); end >= 0 {
+				value = value[1 : end+1]
+			}
+		} else if v, _, found := strings.Cut(value, "#"); found {
+			value = strings.TrimSpace(v)
+		}
+		tables[table][key] = value
+	}
+	return tables
+}
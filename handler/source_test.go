@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// githubStub serves canned github api responses by path
+type githubStub map[string]any
+
+func (g githubStub) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	if v, ok := g[r.URL.Path]; ok {
+		json.NewEncoder(w).Encode(v)
+	} else {
+		http.NotFound(w, r)
+	}
+	return w.Result(), nil
+}
+
+func repoFile(content string) ghContent {
+	return ghContent{Type: "file", Content: base64.StdEncoding.EncodeToString([]byte(content)), Encoding: "base64"}
+}
+
+func TestSource(t *testing.T) {
+	release := ghRelease{TagName: "v1.2.0"}
+	stub := githubStub{
+		"/repos/acme/gotool/releases/latest":     release,
+		"/repos/acme/gotool/contents/go.mod":     repoFile("module example.com/gotool/v2\n\ngo 1.22\n"),
+		"/repos/acme/gotool/contents/cmd/gotool": []ghContent{{Type: "file", Name: "main.go"}},
+		"/repos/acme/rstool/releases/latest":     release,
+		"/repos/acme/rstool/contents/Cargo.toml": repoFile("[workspace]\nmembers = []\n\n[package]\nname = \"rs-tool\"\nversion = \"1.2.0\"\n"),
+		"/repos/acme/pytool/releases/latest":     release,
+	}
+	h := &Handler{Client: &http.Client{Transport: stub}}
+	get := func(target string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		b, _ := io.ReadAll(w.Result().Body)
+		return w.Code, string(b)
+	}
+	for target, expected := range map[string]string{
+		"/acme/gotool?type=script&source=1": `GOBIN="$TMP_DIR/bin" go install "$PKG@$TAG"`,
+		"/acme/gotool?type=sh&source=1":     `PKG="example.com/gotool/v2/cmd/gotool"`,
+		"/acme/gotool?type=text&source=1":   "source-build: go install example.com/gotool/v2/cmd/gotool@v1.2.0",
+		"/acme/rstool?type=script&source=1": `PKG="rs-tool"`,
+		"/acme/rstool?type=text&source=1":   "cargo install --locked --git https://github.com/acme/rstool --tag v1.2.0 rs-tool",
+	} {
+		code, body := get(target)
+		if code != http.StatusOK || !strings.Contains(body, expected) {
+			t.Fatalf("%s: expected %q, got %d: %s", target, expected, code, body)
+		}
+	}
+	// source builds are opt-in, script only, and require a go.mod or Cargo.toml
+	for target, expected := range map[string]string{
+		"/acme/gotool?type=script":            "no assets found",
+		"/acme/gotool?type=homebrew&source=1": "source builds are only available as install scripts",
+		"/acme/pytool?type=script&source=1":   "no go.mod or Cargo.toml",
+	} {
+		code, body := get(target)
+		if code == http.StatusOK || !strings.Contains(body, expected) {
+			t.Fatalf("%s: expected error %q, got %d: %s", target, expected, code, body)
+		}
+	}
+}
+
+func TestCargoPackage(t *testing.T) {
+	for toml, expected := range map[string]string{
+		"[package]\nname = \"tool\"\n":                           "tool",
+		"[package]\nversion = \"1\"\nname='tool-cli'\n":          "tool-cli",
+		"[workspace]\nmembers = [\"a\"]\n":                       "",
+		"[dependencies]\nname = \"nope\"\n[package]\nname=\"x\"": "x",
+	} {
+		if name := cargoPackage(toml); name != expected {
+			t.Fatalf("expected %q, got %q from:\n%s", expected, name, toml)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"strings"
+	"unicode"
 )
 
 func getOS(s string) string {
@@ -58,10 +59,110 @@ func getArch(s string) string {
 	}
 }
 
+// getVariant returns the sub-architecture of an asset (arm: v5, v6 or v7,
+// amd64: microarchitecture level v2, v3 or v4), or "" when unknown (baseline)
+func getVariant(s, arch string) string {
+	s = strings.ToLower(s)
+	if arch == "amd64" {
+		if m := amd64ReLevel.FindStringSubmatch(s); m != nil {
+			return "v" + m[1]
+		}
+		return ""
+	}
+	if arch != "arm" {
+		return ""
+	}
+	switch {
+	case armReVersion.MatchString(s):
+		return "v" + armReVersion.FindStringSubmatch(s)[1]
+	case armReHF.MatchString(s):
+		return "v7"
+	case armReEL.MatchString(s):
+		return "v5"
+	case armReRust.MatchString(s):
+		return "v6"
+	default:
+		return ""
+	}
+}
+
+// getLibc returns the libc a linux asset is linked against,
+// or "" when unknown (usually static)
+func getLibc(s string) string {
+	s = strings.ToLower(s)
+	switch {
+	case libcReMusl.MatchString(s):
+		return "musl"
+	case libcReGnu.MatchString(s):
+		return "gnu"
+	default:
+		return ""
+	}
+}
+
 func getFileExt(s string) string {
 	return fileExtRe.FindString(s)
 }
 
+// isSafeDir reports whether dir can be embedded in a script as a directory
+func isSafeDir(dir string) bool {
+	return safeDirRe.MatchString(dir)
+}
+
+// formulaClass converts a formula name into a class name,
+// the same way as homebrew (Formulary.class_s)
+func formulaClass(name string) string {
+	b := strings.Builder{}
+	upper := true
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r == '-' || r == '_' || r == '.' || unicode.IsSpace(r):
+			upper = true
+		case r == '+':
+			b.WriteRune('x')
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// matchesRelease reports whether a release tag satisfies a version
+// constraint, which is either the exact tag or a version prefix
+// (v1.9 and 1.9 match v1.9.8, but not v1.90.0)
+func matchesRelease(tag, constraint string) bool {
+	if tag == constraint {
+		return true
+	}
+	t := strings.TrimPrefix(tag, "v")
+	c := strings.TrimPrefix(constraint, "v")
+	return c != "" && (t == c || strings.HasPrefix(t, c+"."))
+}
+
+// fileSuffixes are the response types addressed as files: homebrew
+// tap formulas, nix expressions, scoop manifests (scoop names apps
+// after the manifest file) and github actions composite action files
+var fileSuffixes = []struct{ suffix, qtype string }{
+	{".rb", "homebrew"},
+	{".nix", "nix"},
+	{".json", "scoop"},
+	{"/action.yml", "action"},
+}
+
+// trimFileSuffix removes the file suffix of a file style route, only
+// when the rest of the path is a <user>/<repo>@<release> route
+func trimFileSuffix(path string) (string, string) {
+	for _, f := range fileSuffixes {
+		if rest, ok := strings.CutSuffix(path, f.suffix); ok && routeRe.MatchString(rest) {
+			return rest, f.qtype
+		}
+	}
+	return path, ""
+}
+
 func splitHalf(s, by string) (string, string) {
 	i := strings.Index(s, by)
 	if i == -1 {
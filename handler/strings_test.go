@@ -12,6 +12,13 @@ func TestFilExt(t *testing.T) {
 		{"my.file.bz2", ".bz2"},
 		{"my.file.gz", ".gz"},
 		{"my.file.tar.zip", ".tar.zip"}, // :(
+		{"my.file.tar.zst", ".tar.zst"},
+		{"my.file.tar.lz", ".tar.lz"},
+		{"my.file.lz4", ".lz4"},
+		{"my.file.xz", ".xz"},
+		{"my.file.7z", ".7z"},
+		{"my-file-x86_64.AppImage", ".AppImage"},
+		{"my-file-1.2.3", ""},
 	}
 	for _, tc := range tests {
 		ext := getFileExt(tc.file)
@@ -54,6 +61,8 @@ func TestOSArch(t *testing.T) {
 		{"croc_v10.2.1_macOS-64bit.tar.gz", "darwin", "amd64"},
 		{"croc_v10.2.1_Windows-64bit.zip", "windows", "amd64"},
 		{"uv-x86_64-unknown-linux-musl.tar.gz", "linux", "amd64"},
+		{"uv-x86_64_v3-unknown-linux-musl.tar.gz", "linux", "amd64"},
+		{"tool_1.0_linux_amd64v2.tar.gz", "linux", "amd64"},
 		{"uv-x86_64-apple-darwin.tar.gz", "darwin", "amd64"},
 		{"uv-x86_64-pc-windows-msvc.zip", "windows", "amd64"},
 		// 32bit
@@ -145,6 +154,65 @@ func TestOSArch(t *testing.T) {
 	}
 }
 
+func TestVariant(t *testing.T) {
+	for _, tc := range []struct {
+		name, variant string
+	}{
+		{"gitleaks_8.24.0_linux_armv6.tar.gz", "v6"},
+		{"gitleaks_8.24.0_linux_armv7.tar.gz", "v7"},
+		{"yt-dlp_linux_armv7l", "v7"},
+		{"gg-linux-armv5", "v5"},
+		{"tool_1.0_linux_armhf.tar.gz", "v7"},
+		{"tool_1.0_linux_armel.tar.gz", "v5"},
+		{"uv-arm-unknown-linux-musleabihf.tar.gz", "v6"},
+		{"ripgrep-14.1.1-armv7-unknown-linux-gnueabihf.tar.gz", "v7"},
+		{"gitui-linux-arm.tar.gz", ""},
+		// x86-64 microarchitecture levels
+		{"uv-x86_64_v3-unknown-linux-gnu.tar.gz", "v3"},
+		{"tool_1.0_linux_amd64v2.tar.gz", "v2"},
+		{"tool_1.0_linux_amd64_v4.tar.gz", "v4"},
+		{"tool_1.0_linux_amd64_v1.tar.gz", ""},
+		{"uv-x86_64-unknown-linux-gnu.tar.gz", ""},
+	} {
+		if v := getVariant(tc.name, getArch(tc.name)); v != tc.variant {
+			t.Fatalf("getVariant(%s) = %q, want %q", tc.name, v, tc.variant)
+		}
+	}
+}
+
+func TestLibc(t *testing.T) {
+	for _, tc := range []struct {
+		name, libc string
+	}{
+		{"uv-x86_64-unknown-linux-musl.tar.gz", "musl"},
+		{"uv-x86_64-unknown-linux-gnu.tar.gz", "gnu"},
+		{"uv-arm-unknown-linux-musleabihf.tar.gz", "musl"},
+		{"ripgrep-14.1.1-armv7-unknown-linux-gnueabihf.tar.gz", "gnu"},
+		{"yt-dlp_musllinux.zip", "musl"},
+		{"gitleaks_8.24.0_linux_x64.tar.gz", ""},
+		{"bat-v0.25.0-x86_64-unknown-linux-gnu.tar.gz", "gnu"},
+	} {
+		if libc := getLibc(tc.name); libc != tc.libc {
+			t.Fatalf("getLibc(%s) = %q, want %q", tc.name, libc, tc.libc)
+		}
+	}
+}
+
+func TestAssetsPrimary(t *testing.T) {
+	assets := Assets{
+		{OS: "linux", Arch: "amd64", Libc: "musl", Name: "musl"},
+		{OS: "linux", Arch: "amd64", Libc: "gnu", Name: "gnu"},
+		{OS: "linux", Arch: "arm64", Libc: "gnu", Name: "arm64-gnu"},
+	}
+	primary := assets.Primary()
+	if len(primary) != 2 || primary[0].Name != "musl" || primary[1].Name != "arm64-gnu" {
+		t.Fatalf("unexpected primary assets: %+v", primary)
+	}
+	if p := assets[0].Platform(); p != "linux_amd64_musl" {
+		t.Fatalf("unexpected platform %s", p)
+	}
+}
+
 func TestQueryCacheKey(t *testing.T) {
 	q := Query{
 		User:    "testuser",
@@ -295,3 +363,101 @@ func TestSplitHalf(t *testing.T) {
 		})
 	}
 }
+
+func TestSafeDir(t *testing.T) {
+	for _, tc := range []struct {
+		dir  string
+		safe bool
+	}{
+		{"/usr/local/bin", true},
+		{"/opt/my-tools/bin", true},
+		{"~", true},
+		{"~/.local/bin", true},
+		{"bin", true},
+		{"./bin", true},
+		{"~root/bin", false},
+		{"-rf", false},
+		{"/tmp/$(id)", false},
+		{"/tmp/`id`", false},
+		{"/tmp/a b", false},
+		{"/tmp/\"", false},
+		{"/tmp/a;id", false},
+		{"/tmp/a\nid", false},
+		{"", false},
+	} {
+		if got := isSafeDir(tc.dir); got != tc.safe {
+			t.Fatalf("isSafeDir(%q) = %v, want %v", tc.dir, got, tc.safe)
+		}
+	}
+}
+
+func TestFormulaClass(t *testing.T) {
+	for name, class := range map[string]string{
+		"serve":       "Serve",
+		"gitHub-cli":  "GithubCli",
+		"yt-dlp":      "YtDlp",
+		"tmux_static": "TmuxStatic",
+		"c++":         "Cxx",
+		"node.js":     "NodeJs",
+	} {
+		if got := formulaClass(name); got != class {
+			t.Fatalf("formulaClass(%s) = %s, want %s", name, got, class)
+		}
+	}
+}
+
+func TestMatchesRelease(t *testing.T) {
+	tests := []struct {
+		tag, constraint string
+		want            bool
+	}{
+		{"v1.9.8", "v1.9.8", true},
+		{"v1.9.8", "1.9.8", true},
+		{"v1.9.8", "v1.9", true},
+		{"v1.9.8", "1", true},
+		{"1.9.8", "v1.9", true},
+		{"v1.90.0", "v1.9", false},
+		{"v1.9.8", "v1.9.8.1", false},
+		{"nightly", "v", false},
+		{"2024.01.02", "2024.01", true},
+	}
+	for _, tc := range tests {
+		if got := matchesRelease(tc.tag, tc.constraint); got != tc.want {
+			t.Fatalf("matchesRelease(%s, %s) = %v, want %v", tc.tag, tc.constraint, got, tc.want)
+		}
+	}
+}
+
+func TestTrimFileSuffix(t *testing.T) {
+	tests := []struct {
+		path, want, qtype string
+	}{
+		{"/jpillora/serve.rb", "/jpillora/serve", "homebrew"},
+		{"/jpillora/serve@v1.9.8.nix", "/jpillora/serve@v1.9.8", "nix"},
+		{"/serve.json", "/serve", "scoop"},
+		{"/jpillora/serve@v1.9.8/action.yml", "/jpillora/serve@v1.9.8", "action"},
+		{"/jpillora/serve", "/jpillora/serve", ""},
+		{"/.json", "/.json", ""},
+		{"/a/b/c.rb", "/a/b/c.rb", ""},
+		{"/jpillora/serve.sig", "/jpillora/serve.sig", ""},
+	}
+	for _, tc := range tests {
+		if got, qtype := trimFileSuffix(tc.path); got != tc.want || qtype != tc.qtype {
+			t.Fatalf("trimFileSuffix(%s) = %s %s, want %s %s", tc.path, got, qtype, tc.want, tc.qtype)
+		}
+	}
+}
+
+func TestStageName(t *testing.T) {
+	for as, want := range map[string]string{
+		"":         "tool",
+		"rg":       "rg",
+		"My.Tool":  "my.tool",
+		"g++":      "g--",
+		"yt-dlp_2": "yt-dlp_2",
+	} {
+		if got := (Query{Program: "tool", AsProgram: as}).StageName(); got != want {
+			t.Fatalf("StageName(%s) = %s, want %s", as, got, want)
+		}
+	}
+}
@@ -31,13 +31,29 @@ func main() {
 	if c.ForceRepo != "" {
 		log.Printf("locked repo to '%s'", c.ForceRepo)
 	}
+	aliases, err := handler.LoadAliases(c.Aliases)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("loaded %d program aliases", len(aliases))
+	weights, err := handler.ParseWeights(c.Weights)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signer, err := handler.LoadSigner(c.SigningKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if signer != nil {
+		log.Printf("signing responses with %s", signer.PublicKey())
+	}
 	addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
 	l, err := net.Listen("tcp4", addr)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Printf("listening on %s...", addr)
-	h := &handler.Handler{Config: c}
+	h := &handler.Handler{Config: c, Aliases: aliases, Weights: weights, Signer: signer}
 	lh := requestlog.New(h, requestlog.Options{
 		TrustProxy: true, // assume will be run in paas
 		Filter: func(r *http.Request, code int, duration time.Duration, size int64) bool {
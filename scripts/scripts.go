@@ -8,5 +8,44 @@ var Text []byte
 //go:embed install.sh.tmpl
 var Shell []byte
 
+//go:embed install.posix.sh.tmpl
+var POSIXShell []byte
+
+// Common contains template definitions shared by the shell scripts
+//
+//go:embed common.sh.tmpl
+var Common []byte
+
 //go:embed install.rb.tmpl
 var Homebrew []byte
+
+//go:embed install.nix.tmpl
+var Nix []byte
+
+//go:embed install.dockerfile.tmpl
+var Dockerfile []byte
+
+//go:embed install.action.yml.tmpl
+var Action []byte
+
+//go:embed install.ansible.yml.tmpl
+var Ansible []byte
+
+//go:embed install.cloud-init.yml.tmpl
+var CloudInit []byte
+
+//go:embed install.lock.sh.tmpl
+var Lock []byte
+
+//go:embed install.bundle.sh.tmpl
+var Bundle []byte
+
+// Source builds releases without binary assets, using go or cargo
+//
+//go:embed install.source.sh.tmpl
+var Source []byte
+
+// Verify checks the signature of installer scripts (see handler.Signer)
+//
+//go:embed verify.sh.tmpl
+var Verify []byte